@@ -0,0 +1,105 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+
+	"k8s.io/klog/v2"
+
+	"k8s.io/registry.k8s.io/pkg/net/cidrs"
+	"k8s.io/registry.k8s.io/pkg/net/clientip"
+	"k8s.io/registry.k8s.io/pkg/net/cloudcidrs"
+)
+
+// makeAdminHandler returns the handler for operator debugging endpoints
+// under /admin/
+//
+// These are only served to requests bearing rc.AdminToken, if no token is
+// configured they are not served at all.
+func makeAdminHandler(rc RegistryConfig, slowest *slowRequests, cache *blobCache) http.Handler {
+	if rc.AdminToken == "" {
+		return http.NotFoundHandler()
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/slowest", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, slowest.Snapshot())
+	})
+	mux.HandleFunc("GET /admin/diagnostics", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, collectDiagnostics(rc, cache))
+	})
+	regionMapper := cloudcidrs.NewIPMapper()
+	mux.HandleFunc("POST /admin/resolve-client", func(w http.ResponseWriter, r *http.Request) {
+		req := resolveClientRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, resolveClient(rc, regionMapper, req))
+	})
+	expectedAuth := []byte("Bearer " + rc.AdminToken)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expectedAuth) != 1 {
+			klog.V(2).InfoS("unauthorized admin request", "path", r.URL.Path)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// writeJSON serves v as a JSON response
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	// errors writing here mean the client went away, there's nothing to do
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// resolveClientRequest is the request body for /admin/resolve-client
+type resolveClientRequest struct {
+	RemoteAddr    string `json:"remoteAddr"`
+	XForwardedFor string `json:"xForwardedFor"`
+}
+
+// resolveClientResponse is the response body for /admin/resolve-client
+type resolveClientResponse struct {
+	ClientIP  string `json:"clientIP,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+	Cloud     string `json:"cloud,omitempty"`
+	Region    string `json:"region,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// resolveClient resolves the client IP for req the same way registry API
+// requests are resolved, so operators can check their proxy configuration
+func resolveClient(rc RegistryConfig, regionMapper cidrs.IPMapper[cloudcidrs.IPInfo], req resolveClientRequest) resolveClientResponse {
+	r := &http.Request{RemoteAddr: req.RemoteAddr, Header: http.Header{}}
+	if req.XForwardedFor != "" {
+		r.Header.Set("X-Forwarded-For", req.XForwardedFor)
+	}
+	ip, truncated, err := clientip.GetLimited(r, rc.MaxForwardedForEntries)
+	if err != nil {
+		return resolveClientResponse{Truncated: truncated, Error: err.Error()}
+	}
+	resp := resolveClientResponse{ClientIP: ip.String(), Truncated: truncated}
+	if info, ok := regionMapper.GetIP(ip); ok {
+		resp.Cloud, resp.Region = info.Cloud, info.Region
+	}
+	return resp
+}
@@ -0,0 +1,265 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/registry.k8s.io/pkg/net/cloudcidrs"
+)
+
+const testAdminToken = "s3cr3t"
+
+// newAdminRequest returns a request for an admin endpoint bearing token
+func newAdminRequest(method, path, token string) *http.Request {
+	r := httptest.NewRequest(method, "http://localhost:8080"+path, nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return r
+}
+
+func TestMakeAdminHandlerAuth(t *testing.T) {
+	testCases := []struct {
+		Name           string
+		AdminToken     string
+		Request        *http.Request
+		ExpectedStatus int
+	}{
+		{
+			Name:           "admin disabled",
+			AdminToken:     "",
+			Request:        newAdminRequest("GET", "/admin/slowest", ""),
+			ExpectedStatus: http.StatusNotFound,
+		},
+		{
+			Name:           "no token",
+			AdminToken:     testAdminToken,
+			Request:        newAdminRequest("GET", "/admin/slowest", ""),
+			ExpectedStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:           "wrong token",
+			AdminToken:     testAdminToken,
+			Request:        newAdminRequest("GET", "/admin/slowest", "guess"),
+			ExpectedStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:           "valid token",
+			AdminToken:     testAdminToken,
+			Request:        newAdminRequest("GET", "/admin/slowest", testAdminToken),
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			Name:           "valid token, unknown endpoint",
+			AdminToken:     testAdminToken,
+			Request:        newAdminRequest("GET", "/admin/bogus", testAdminToken),
+			ExpectedStatus: http.StatusNotFound,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			handler := makeAdminHandler(RegistryConfig{AdminToken: tc.AdminToken}, newSlowRequests(10, time.Hour), &blobCache{})
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, tc.Request)
+			if recorder.Code != tc.ExpectedStatus {
+				t.Fatalf("expected status: %d, but got status: %d", tc.ExpectedStatus, recorder.Code)
+			}
+		})
+	}
+}
+
+// slowBlobsChecker is a fakeBlobsChecker that takes delay to respond
+type slowBlobsChecker struct {
+	fakeBlobsChecker
+	delay time.Duration
+}
+
+func (s *slowBlobsChecker) BlobExists(ctx context.Context, blobURL string) (bool, error) {
+	time.Sleep(s.delay)
+	return s.fakeBlobsChecker.BlobExists(ctx, blobURL)
+}
+
+func TestAdminSlowest(t *testing.T) {
+	registryConfig := RegistryConfig{
+		UpstreamRegistryEndpoint: "https://k8s.gcr.io",
+		AdminToken:               testAdminToken,
+	}
+	slowest := newSlowRequests(10, time.Hour)
+	blobs := &slowBlobsChecker{delay: 20 * time.Millisecond}
+	v2 := makeV2Handler(context.Background(), registryConfig, blobs, &fakeBlobProxy{}, slowest, nil, nil)
+	admin := makeAdminHandler(registryConfig, slowest, &blobCache{})
+
+	// a fast manifest request and a slower blob request
+	v2(httptest.NewRecorder(), httptest.NewRequest("GET", "http://localhost:8080/v2/pause/manifests/latest", nil))
+	blobRequest := httptest.NewRequest("GET", "http://localhost:8080/v2/pause/blobs/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e", nil)
+	blobRequest.RemoteAddr = "35.180.1.1:888"
+	v2(httptest.NewRecorder(), blobRequest)
+
+	recorder := httptest.NewRecorder()
+	admin.ServeHTTP(recorder, newAdminRequest("GET", "/admin/slowest", testAdminToken))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status: %d, but got status: %d", http.StatusOK, recorder.Code)
+	}
+	requests := []slowRequest{}
+	if err := json.NewDecoder(recorder.Body).Decode(&requests); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	assertSlowRequestPaths(t, requests,
+		"/v2/pause/blobs/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e",
+		"/v2/pause/manifests/latest",
+	)
+	if requests[0].ClientRegion != "eu-west-3" || requests[0].Backend != registryConfig.UpstreamRegistryEndpoint {
+		t.Fatalf("unexpected request recorded: %+v", requests[0])
+	}
+	if requests[0].Duration < blobs.delay {
+		t.Fatalf("expected blob request to take at least %v, got: %v", blobs.delay, requests[0].Duration)
+	}
+}
+
+func TestAdminDiagnostics(t *testing.T) {
+	registryConfig := RegistryConfig{
+		UpstreamRegistryEndpoint: "https://k8s.gcr.io",
+		AdminToken:               testAdminToken,
+	}
+	cache := &blobCache{}
+	cache.Put("https://example.com/containers/images/sha256:abc", blobCacheEntry{created: time.Now()})
+	admin := makeAdminHandler(registryConfig, newSlowRequests(10, time.Hour), cache)
+
+	recorder := httptest.NewRecorder()
+	admin.ServeHTTP(recorder, newAdminRequest("GET", "/admin/diagnostics", testAdminToken))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status: %d, but got status: %d", http.StatusOK, recorder.Code)
+	}
+	body := recorder.Body.String()
+	if strings.Contains(body, testAdminToken) {
+		t.Fatalf("expected admin token to be redacted, got: %s", body)
+	}
+	bundle := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(body), &bundle); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	for _, section := range []string{"config", "dataVersion", "regions", "buckets", "cache", "build"} {
+		if _, ok := bundle[section]; !ok {
+			t.Fatalf("expected %q section in diagnostics, got: %s", section, body)
+		}
+	}
+	d := diagnostics{}
+	if err := json.Unmarshal([]byte(body), &d); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if d.Cache.BlobEntries != 1 {
+		t.Fatalf("expected 1 cached blob, got: %d", d.Cache.BlobEntries)
+	}
+	if d.DataVersion != cloudcidrs.DataVersion() {
+		t.Fatalf("expected data version: %q, got: %q", cloudcidrs.DataVersion(), d.DataVersion)
+	}
+	if d.Regions["AWS"] == 0 || d.Regions["GCP"] == 0 {
+		t.Fatalf("expected AWS and GCP regions, got: %v", d.Regions)
+	}
+	if d.Buckets["eu-west-3"] != awsRegionToHostURL("eu-west-3", "") {
+		t.Fatalf("expected eu-west-3 bucket, got: %v", d.Buckets)
+	}
+	if d.Build.GoVersion == "" {
+		t.Fatal("expected build info")
+	}
+	if config := d.Config.(map[string]any); config["AdminToken"] != "REDACTED" {
+		t.Fatalf("expected redacted admin token, got: %v", config["AdminToken"])
+	}
+}
+
+func TestAdminResolveClient(t *testing.T) {
+	testCases := []struct {
+		Name           string
+		Body           string
+		ExpectedStatus int
+		Expected       resolveClientResponse
+	}{
+		{
+			Name:           "direct connection",
+			Body:           `{"remoteAddr": "35.180.1.1:888"}`,
+			ExpectedStatus: http.StatusOK,
+			Expected:       resolveClientResponse{ClientIP: "35.180.1.1", Cloud: "AWS", Region: "eu-west-3"},
+		},
+		{
+			Name:           "load balancer chain",
+			Body:           `{"remoteAddr": "169.254.1.1:888", "xForwardedFor": "35.180.1.1,130.211.0.1"}`,
+			ExpectedStatus: http.StatusOK,
+			Expected:       resolveClientResponse{ClientIP: "35.180.1.1", Cloud: "AWS", Region: "eu-west-3"},
+		},
+		{
+			Name:           "untrusted client supplied entries are ignored",
+			Body:           `{"remoteAddr": "169.254.1.1:888", "xForwardedFor": "52.208.1.1, 192.0.2.1,35.180.1.1,130.211.0.1"}`,
+			ExpectedStatus: http.StatusOK,
+			Expected:       resolveClientResponse{ClientIP: "35.180.1.1", Truncated: true, Cloud: "AWS", Region: "eu-west-3"},
+		},
+		{
+			Name:           "unknown client",
+			Body:           `{"remoteAddr": "169.254.1.1:888", "xForwardedFor": "192.0.2.1,130.211.0.1"}`,
+			ExpectedStatus: http.StatusOK,
+			Expected:       resolveClientResponse{ClientIP: "192.0.2.1"},
+		},
+		{
+			Name:           "missing load balancer entry",
+			Body:           `{"remoteAddr": "169.254.1.1:888", "xForwardedFor": "35.180.1.1"}`,
+			ExpectedStatus: http.StatusOK,
+			Expected:       resolveClientResponse{Error: "invalid X-Forwarded-For value: 35.180.1.1"},
+		},
+		{
+			Name:           "invalid request",
+			Body:           `{`,
+			ExpectedStatus: http.StatusBadRequest,
+		},
+	}
+	registryConfig := RegistryConfig{
+		AdminToken:             testAdminToken,
+		MaxForwardedForEntries: 3,
+	}
+	admin := makeAdminHandler(registryConfig, newSlowRequests(10, time.Hour), &blobCache{})
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			r := newAdminRequest("POST", "/admin/resolve-client", testAdminToken)
+			r.Body = io.NopCloser(strings.NewReader(tc.Body))
+			recorder := httptest.NewRecorder()
+			admin.ServeHTTP(recorder, r)
+			if recorder.Code != tc.ExpectedStatus {
+				t.Fatalf("expected status: %d, but got status: %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if tc.ExpectedStatus != http.StatusOK {
+				return
+			}
+			resp := resolveClientResponse{}
+			if err := json.NewDecoder(recorder.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if resp != tc.Expected {
+				t.Fatalf("expected response: %+v, but got: %+v", tc.Expected, resp)
+			}
+		})
+	}
+}
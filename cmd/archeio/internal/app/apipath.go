@@ -0,0 +1,56 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"fmt"
+	"strings"
+)
+
+// apiVerbs are the registry API path components following a repository name
+// https://github.com/opencontainers/distribution-spec/blob/main/spec.md#endpoints
+var apiVerbs = map[string]bool{
+	"manifests": true,
+	"blobs":     true,
+	"tags":      true,
+	"referrers": true,
+}
+
+// parseAPIPath splits a registry API path like /v2/<name>/<verb>/<reference>
+// into the repository name and verb, or returns "" for both if the path has
+// no verb
+//
+// Verbs are only recognized in this canonical position, a verb anywhere else
+// in the path (e.g. /v2/<name>/manifests/<digest>/blobs/<digest>) is an error
+// rather than being treated as part of the repository name.
+func parseAPIPath(apiPath string) (name, verb string, err error) {
+	parts := strings.Split(strings.TrimPrefix(apiPath, "/v2/"), "/")
+	// the last component is the reference, which may be a tag named like a verb
+	for i := 0; i < len(parts)-1; i++ {
+		if !apiVerbs[parts[i]] {
+			continue
+		}
+		if i == 0 {
+			return "", "", fmt.Errorf("missing repository name before %q", parts[i])
+		}
+		if i != len(parts)-2 {
+			return "", "", fmt.Errorf("%q is not followed by a single reference", parts[i])
+		}
+		return strings.Join(parts[:i], "/"), parts[i], nil
+	}
+	return "", "", nil
+}
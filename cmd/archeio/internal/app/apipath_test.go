@@ -0,0 +1,61 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import "testing"
+
+func TestParseAPIPath(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		Path         string
+		ExpectedName string
+		ExpectedVerb string
+		ExpectError  bool
+	}{
+		{Path: "/v2/pause/manifests/latest", ExpectedName: "pause", ExpectedVerb: "manifests"},
+		{Path: "/v2/sig-storage/nfs/blobs/sha256:abc", ExpectedName: "sig-storage/nfs", ExpectedVerb: "blobs"},
+		{Path: "/v2/pause/tags/list", ExpectedName: "pause", ExpectedVerb: "tags"},
+		{Path: "/v2/pause/referrers/sha256:abc", ExpectedName: "pause", ExpectedVerb: "referrers"},
+		{Path: "/v2/pause/manifests/blobs", ExpectedName: "pause", ExpectedVerb: "manifests"},
+		{Path: "/v2/pause/unknown/latest"},
+		{Path: "/v2/pause/"},
+		{Path: "/v2/"},
+		{Path: "/v2/pause/manifests/sha256:abc/blobs/sha256:def", ExpectError: true},
+		{Path: "/v2/pause/blobs/sha256:abc/manifests/latest", ExpectError: true},
+		{Path: "/v2/pause/tags/list/referrers/sha256:abc", ExpectError: true},
+		{Path: "/v2/pause/manifests/latest/extra", ExpectError: true},
+		{Path: "/v2/blobs/sha256:abc", ExpectError: true},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Path, func(t *testing.T) {
+			t.Parallel()
+			name, verb, err := parseAPIPath(tc.Path)
+			if err != nil {
+				if !tc.ExpectError {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			} else if tc.ExpectError {
+				t.Fatal("expected error but got none")
+			}
+			if name != tc.ExpectedName || verb != tc.ExpectedVerb {
+				t.Fatalf("expected (%q, %q), got (%q, %q)", tc.ExpectedName, tc.ExpectedVerb, name, verb)
+			}
+		})
+	}
+}
@@ -17,11 +17,20 @@ limitations under the License.
 package app
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"hash/fnv"
 	"net/http"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"k8s.io/klog/v2"
+
+	"k8s.io/registry.k8s.io/pkg/net/cloudcidrs"
 )
 
 // awsRegionToHostURL returns the base S3 bucket URL for an OCI layer blob given the AWS region
@@ -144,11 +153,225 @@ func awsRegionToHostURL(region, defaultURL string) string {
 	}
 }
 
+// BackendConfig is optional per-backend configuration, see RegistryConfig.Backends
+type BackendConfig struct {
+	// KeySuffix is appended to blob object URLs for this backend, e.g. to
+	// select an object version for buckets using versioning or object-lock
+	KeySuffix string `json:"keySuffix,omitempty"`
+	// ForwardQuery appends the client's query string to redirects to this
+	// backend, e.g. for CDN auth tokens
+	//
+	// This is off by default as it may break signed URLs.
+	ForwardQuery bool `json:"forwardQuery,omitempty"`
+	// MaxConcurrentProbes limits concurrent blob existence probes to this
+	// backend, so that smaller backends are not overwhelmed, 0 means no limit
+	MaxConcurrentProbes int `json:"maxConcurrentProbes,omitempty"`
+}
+
+// blobPathPrefix is the path blobs are stored under in our buckets,
+// this matches GCR's GCS layout, which we will use for other buckets
+const blobPathPrefix = "/containers/images/"
+
+// bucketBlobURL returns the URL for digest in the bucket at bucketURL
+func bucketBlobURL(rc RegistryConfig, bucketURL, digest string) string {
+	return bucketURL + blobPathPrefix + digest + rc.Backends[bucketURL].KeySuffix
+}
+
+// withQuery returns blobURL with rawQuery appended
+func withQuery(blobURL, rawQuery string) string {
+	if rawQuery == "" {
+		return blobURL
+	}
+	if strings.Contains(blobURL, "?") {
+		return blobURL + "&" + rawQuery
+	}
+	return blobURL + "?" + rawQuery
+}
+
+// bucket is an AWS bucket we host blobs in, for alternateBucketURLs
+type bucket struct {
+	region string
+	url    string
+}
+
+// knownBuckets returns all distinct buckets awsRegionToHostURL maps to,
+// sorted by region
+func knownBuckets() []bucket {
+	regions := []string{}
+	for _, ipInfo := range cloudcidrs.AllIPInfos() {
+		if ipInfo.Cloud == cloudcidrs.AWS {
+			regions = append(regions, ipInfo.Region)
+		}
+	}
+	sort.Strings(regions)
+	seen := map[string]bool{}
+	buckets := []bucket{}
+	for _, region := range regions {
+		url := awsRegionToHostURL(region, "")
+		if url == "" || seen[url] {
+			continue
+		}
+		seen[url] = true
+		buckets = append(buckets, bucket{region: region, url: url})
+	}
+	return buckets
+}
+
+// alternateBucketURLs returns up to limit bucket URLs from buckets other
+// than bucketURL, preferring buckets in the same geography as region
+// based on the region name prefix (e.g. "eu-" for "eu-west-3")
+//
+// A limit of 0 or less returns none.
+func alternateBucketURLs(buckets []bucket, region, bucketURL string, limit int) []string {
+	if limit <= 0 {
+		return nil
+	}
+	geography, _, _ := strings.Cut(region, "-")
+	near := []string{}
+	far := []string{}
+	for _, b := range buckets {
+		if b.url == bucketURL {
+			continue
+		}
+		if bucketGeography, _, _ := strings.Cut(b.region, "-"); bucketGeography == geography {
+			near = append(near, b.url)
+		} else {
+			far = append(far, b.url)
+		}
+	}
+	alternates := append(near, far...)
+	if len(alternates) > limit {
+		alternates = alternates[:limit]
+	}
+	return alternates
+}
+
+// ValidateBlobAlternateLinks returns an error if limit is negative
+func ValidateBlobAlternateLinks(limit int) error {
+	if limit < 0 {
+		return fmt.Errorf("invalid blob alternate links %d, expected 0 or more", limit)
+	}
+	return nil
+}
+
+// Tie-breaker policies for costAwareBucketURLs candidates with equal scores
+const (
+	// TieBreakOrder prefers the usual bucket and then region order
+	TieBreakOrder = "order"
+	// TieBreakDigest orders tied buckets by a hash of the blob digest, so each
+	// blob is consistently served from one bucket for backend cache locality
+	// while blobs overall are spread across the tied buckets
+	TieBreakDigest = "digest"
+)
+
+// ValidateCostWeight returns an error if costWeight is outside [0, 1]
+func ValidateCostWeight(costWeight float64) error {
+	if costWeight < 0 || costWeight > 1 {
+		return fmt.Errorf("invalid cost weight %v, expected between 0 and 1", costWeight)
+	}
+	return nil
+}
+
+// costAwareBucketURLs returns candidate bucket URLs for a client in region,
+// most preferred first, for finding the cheapest reasonably close bucket
+//
+// Candidates are bucketURL, the client's usual bucket, and other buckets in
+// the same geography as region. They are scored by a mix of proximity and
+// egress cost relative to the most expensive candidate, with costWeight
+// between 0 (proximity only) and 1 (cost only). Proximity is 0 for the usual
+// bucket, 0.5 for buckets in the same area (e.g. eu-west) and 1 otherwise, so
+// at costWeight 0.5 a cheaper bucket in the same area can be preferred, but
+// buckets elsewhere in the geography only above 0.5.
+// Buckets without a configured cost are treated as the most expensive.
+// Candidates with equal scores are ordered according to tieBreaker.
+func costAwareBucketURLs(buckets []bucket, region, bucketURL, digest string, costPerGB map[string]float64, costWeight float64, tieBreaker string) []string {
+	type candidate struct {
+		url       string
+		proximity float64
+		cost      float64
+		known     bool
+		tieKey    uint64
+	}
+	geography, _, _ := strings.Cut(region, "-")
+	candidates := []candidate{{url: bucketURL}}
+	for _, b := range buckets {
+		if bucketGeography, _, _ := strings.Cut(b.region, "-"); bucketGeography != geography {
+			continue
+		}
+		if b.url == bucketURL {
+			candidates[0].cost, candidates[0].known = costPerGB[b.region]
+			continue
+		}
+		proximity := 1.0
+		if regionArea(b.region) == regionArea(region) {
+			proximity = 0.5
+		}
+		cost, known := costPerGB[b.region]
+		candidates = append(candidates, candidate{url: b.url, proximity: proximity, cost: cost, known: known})
+	}
+	maxCost := 0.0
+	for i, c := range candidates {
+		maxCost = max(maxCost, c.cost)
+		if tieBreaker == TieBreakDigest {
+			candidates[i].tieKey = digestTieKey(digest, c.url)
+		}
+	}
+	score := func(c candidate) float64 {
+		relativeCost := 1.0
+		if c.known && maxCost > 0 {
+			relativeCost = c.cost / maxCost
+		}
+		return (1-costWeight)*c.proximity + costWeight*relativeCost
+	}
+	// stable, so by default ties keep the usual bucket first and then region order
+	sort.SliceStable(candidates, func(i, j int) bool {
+		si, sj := score(candidates[i]), score(candidates[j])
+		if si != sj {
+			return si < sj
+		}
+		return candidates[i].tieKey < candidates[j].tieKey
+	})
+	urls := make([]string, len(candidates))
+	for i, c := range candidates {
+		urls[i] = c.url
+	}
+	return urls
+}
+
+// regionArea returns region without its trailing number, e.g. eu-west for
+// eu-west-1, regions in the same area are closer than the rest of the geography
+func regionArea(region string) string {
+	if i := strings.LastIndex(region, "-"); i >= 0 {
+		return region[:i]
+	}
+	return region
+}
+
+// digestTieKey returns a rendezvous hash of digest and bucketURL, so that
+// adding or removing a bucket only moves the blobs that preferred it
+func digestTieKey(digest, bucketURL string) uint64 {
+	h := fnv.New64a()
+	// NOTE: hash.Hash never returns an error
+	_, _ = h.Write([]byte(digest + " " + bucketURL))
+	return h.Sum64()
+}
+
 // blobChecker are used to check if a blob exists, possibly with caching
 type blobChecker interface {
 	// BlobExists should check that blobURL exists
 	// bucket and layerHash may be used for caching purposes
-	BlobExists(blobURL string) bool
+	// ctx bounds waiting to check, e.g. the client request's context
+	//
+	// An error is returned if it could not be determined either way, e.g.
+	// the backend failed or did not respond in time, rather than the blob
+	// being confirmed missing.
+	BlobExists(ctx context.Context, blobURL string) (bool, error)
+}
+
+// blobSizer may optionally be implemented by a blobChecker to report the
+// size of blobs it has found, if known
+type blobSizer interface {
+	BlobSize(blobURL string) (int64, bool)
 }
 
 // cachedBlobChecker just performs an HTTP HEAD check against the blob
@@ -157,48 +380,254 @@ type blobChecker interface {
 // should be plenty fast for now, HTTP HEAD on s3 is cheap
 type cachedBlobChecker struct {
 	blobCache
+	// ttl is how long positive results are trusted, 0 means forever
+	ttl time.Duration
+	// serveStaleOnError allows using expired results when probing fails
+	serveStaleOnError bool
+	// disabled bypasses the cache, always probing and never storing results
+	disabled bool
+	// minSize is the minimum known blob size to cache results for
+	minSize int64
+	// transport is used for probes, nil means http.DefaultTransport
+	transport http.RoundTripper
+	// forbiddenExists treats 403 probe responses as the blob existing
+	forbiddenExists bool
+	// verifyETag enables checkBlobETag when probing
+	verifyETag bool
+	// keySuffixes are the KeySuffix appended to blob URLs by bucket URL
+	keySuffixes map[string]string
+	now         func() time.Time
+	// probeSlots bounds concurrent probes by bucket URL
+	probeSlots map[string]chan struct{}
+	// probeSlotTimeout is how long to wait for a free probe slot
+	probeSlotTimeout time.Duration
+}
+
+func newCachedBlobChecker(rc RegistryConfig) *cachedBlobChecker {
+	probeSlots := map[string]chan struct{}{}
+	keySuffixes := map[string]string{}
+	for bucketURL, backend := range rc.Backends {
+		keySuffixes[bucketURL] = backend.KeySuffix
+		if backend.MaxConcurrentProbes > 0 {
+			probeSlots[bucketURL] = make(chan struct{}, backend.MaxConcurrentProbes)
+		}
+	}
+	var transport http.RoundTripper
+	if rc.ProbeRootCAs != nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = &tls.Config{
+			RootCAs:    rc.ProbeRootCAs,
+			MinVersion: tls.VersionTLS12,
+		}
+		transport = t
+	}
+	return &cachedBlobChecker{
+		ttl:               rc.BlobCacheTTL,
+		serveStaleOnError: rc.ServeStaleOnError,
+		disabled:          rc.DisableBlobCache,
+		minSize:           rc.BlobCacheMinSize,
+		transport:         transport,
+		forbiddenExists:   rc.ForbiddenBlobExists,
+		verifyETag:        rc.VerifyBlobETag,
+		keySuffixes:       keySuffixes,
+		now:               time.Now,
+		probeSlots:        probeSlots,
+		probeSlotTimeout:  defaultProbeSlotTimeout,
+	}
+}
+
+// defaultProbeSlotTimeout bounds waiting for MaxConcurrentProbes, past which
+// we would rather send the client upstream than keep it waiting
+const defaultProbeSlotTimeout = time.Second
+
+// errProbeSlotUnavailable is returned by acquireProbe if no slot was free
+var errProbeSlotUnavailable = errors.New("no blob probe slot available")
+
+// acquireProbe waits for a free probe slot for the bucket blobURL is in,
+// if it has a limit, the returned func must be called to release it
+//
+// If no slot frees up within probeSlotTimeout or before ctx is done, an
+// error is returned instead and the probe should be treated as failed.
+func (c *cachedBlobChecker) acquireProbe(ctx context.Context, blobURL string) (func(), error) {
+	bucketURL, _, _ := strings.Cut(blobURL, blobPathPrefix)
+	slots, limited := c.probeSlots[bucketURL]
+	if !limited {
+		return func() {}, nil
+	}
+	timer := time.NewTimer(c.probeSlotTimeout)
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+	probeSlotsExhaustedTotal.Inc()
+	return nil, errProbeSlotUnavailable
 }
 
-func newCachedBlobChecker() *cachedBlobChecker {
-	return &cachedBlobChecker{}
+// limitedProbeBlob is probeBlob within the bucket's MaxConcurrentProbes
+func (c *cachedBlobChecker) limitedProbeBlob(ctx context.Context, blobURL string) (bool, int64, error) {
+	release, err := c.acquireProbe(ctx, blobURL)
+	if err != nil {
+		return false, -1, err
+	}
+	defer release()
+	return c.probeBlob(blobURL)
 }
 
 type blobCache struct {
 	m sync.Map
 }
 
-func (b *blobCache) Get(blobURL string) bool {
-	_, exists := b.m.Load(blobURL)
-	return exists
+// blobCacheEntry records a blob known to exist
+type blobCacheEntry struct {
+	created time.Time
+	// size is the Content-Length reported by the backend, or -1 if unknown
+	size int64
 }
 
-func (b *blobCache) Put(blobURL string) {
-	b.m.Store(blobURL, struct{}{})
+func (b *blobCache) Get(blobURL string) (blobCacheEntry, bool) {
+	v, exists := b.m.Load(blobURL)
+	if !exists {
+		return blobCacheEntry{}, false
+	}
+	return v.(blobCacheEntry), true
 }
 
-func (c *cachedBlobChecker) BlobExists(blobURL string) bool {
-	if c.blobCache.Get(blobURL) {
-		klog.V(3).InfoS("blob existence cache hit", "url", blobURL)
+func (b *blobCache) Put(blobURL string, entry blobCacheEntry) {
+	b.m.Store(blobURL, entry)
+}
+
+func (b *blobCache) Delete(blobURL string) {
+	b.m.Delete(blobURL)
+}
+
+// Len returns the number of cached entries
+func (b *blobCache) Len() int {
+	n := 0
+	b.m.Range(func(_, _ any) bool {
+		n++
 		return true
+	})
+	return n
+}
+
+func (c *cachedBlobChecker) BlobExists(ctx context.Context, blobURL string) (bool, error) {
+	if c.disabled {
+		exists, _, err := c.limitedProbeBlob(ctx, blobURL)
+		return exists && err == nil, err
+	}
+	entry, cached := c.blobCache.Get(blobURL)
+	if cached && (c.ttl == 0 || c.now().Sub(entry.created) < c.ttl) {
+		klog.V(3).InfoS("blob existence cache hit", "url", blobURL)
+		blobCacheEntryAgeSeconds.Observe(c.now().Sub(entry.created).Seconds())
+		return true, nil
 	}
 	klog.V(3).InfoS("blob existence cache miss", "url", blobURL)
-	// NOTE: this client will still share http.DefaultTransport
+	exists, size, err := c.limitedProbeBlob(ctx, blobURL)
+	if err != nil {
+		// if we knew about the blob before, that's a better guess than
+		// assuming the blob is gone because the backend is having trouble
+		if cached && c.serveStaleOnError {
+			klog.V(2).InfoS("serving expired blob existence cache entry", "url", blobURL, "err", err)
+			blobCacheStaleServedTotal.Inc()
+			blobCacheEntryAgeSeconds.Observe(c.now().Sub(entry.created).Seconds())
+			return true, nil
+		}
+		// the caller decides what to do without an answer
+		return false, err
+	}
+	if !exists {
+		c.blobCache.Delete(blobURL)
+		return false, nil
+	}
+	// tiny blobs are cheap to probe, so leave cache capacity for layers
+	// NOTE: blobs of unknown size are still cached
+	if size >= 0 && size < c.minSize {
+		return true, nil
+	}
+	c.blobCache.Put(blobURL, blobCacheEntry{created: c.now(), size: size})
+	return true, nil
+}
+
+// BlobSize returns the size of blobURL if it has been found to exist
+func (c *cachedBlobChecker) BlobSize(blobURL string) (int64, bool) {
+	entry, cached := c.blobCache.Get(blobURL)
+	return entry.size, cached && entry.size >= 0
+}
+
+// probeBlob checks if blobURL exists with an HTTP HEAD request
+//
+// The blob size is also returned if known, else -1.
+// An error is returned if the backend could not tell us either way.
+// Results are counted in blobProbeResultsTotal.
+func (c *cachedBlobChecker) probeBlob(blobURL string) (bool, int64, error) {
+	// NOTE: this client will still share the transport
 	// We do not wish to share the rest of the client state currently
 	client := &http.Client{
+		Transport: c.transport,
 		// ensure sensible timeouts
 		Timeout: time.Second * 5,
 	}
 	r, err := client.Head(blobURL)
-	// fallback to assuming blob is unavailable on errors
 	if err != nil {
-		return false
+		blobProbeResultsTotal.WithLabelValues(probeResultError).Inc()
+		return false, -1, err
 	}
 	r.Body.Close()
+	switch {
 	// if the blob exists it HEAD should return 200 OK
 	// this is true for S3 and for OCI registries
-	if r.StatusCode == http.StatusOK {
-		c.blobCache.Put(blobURL)
+	case r.StatusCode == http.StatusOK:
+		blobProbeResultsTotal.WithLabelValues(probeResultFound).Inc()
+		if c.verifyETag {
+			bucketURL, _, _ := strings.Cut(blobURL, blobPathPrefix)
+			checkBlobETag(blobURL, c.keySuffixes[bucketURL], r.Header.Get("ETag"))
+		}
+		return true, r.ContentLength, nil
+	// public S3 buckets may return 403 for objects that exist but are
+	// misconfigured, rather than 404 for absent objects
+	case r.StatusCode == http.StatusForbidden:
+		blobProbeResultsTotal.WithLabelValues(probeResultForbidden).Inc()
+		return c.forbiddenExists, -1, nil
+	case r.StatusCode >= http.StatusInternalServerError:
+		blobProbeResultsTotal.WithLabelValues(probeResultError).Inc()
+		return false, -1, fmt.Errorf("unexpected status probing blob: %d", r.StatusCode)
+	default:
+		blobProbeResultsTotal.WithLabelValues(probeResultNotFound).Inc()
+		return false, -1, nil
+	}
+}
+
+// checkBlobETag reports if etag, as returned probing blobURL, contradicts
+// the digest in blobURL, which may indicate a corrupted object
+//
+// keySuffix is the bucket's KeySuffix, which follows the digest in blobURL.
+// Only ETags that look like the digest are compared, either in full
+// (sha256:<hex>) or as a bare hex value of the same length. Others, such as
+// S3's MD5 based ETags, are ignored. Mismatches are logged and counted in
+// blobETagMismatchTotal.
+func checkBlobETag(blobURL, keySuffix, etag string) bool {
+	_, digest, found := strings.Cut(blobURL, blobPathPrefix)
+	if !found {
 		return true
 	}
-	return false
+	digest = strings.TrimSuffix(digest, keySuffix)
+	_, hash, _ := strings.Cut(digest, ":")
+	etag = strings.Trim(strings.TrimPrefix(etag, "W/"), `"`)
+	var matches bool
+	switch {
+	case strings.Contains(etag, ":"):
+		matches = etag == digest
+	case len(etag) == len(hash):
+		matches = strings.EqualFold(etag, hash)
+	default:
+		return true
+	}
+	if !matches {
+		klog.ErrorS(nil, "blob ETag does not match digest, object may be corrupt", "url", blobURL, "etag", etag)
+		blobETagMismatchTotal.Inc()
+	}
+	return matches
 }
@@ -20,6 +20,7 @@ package app
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"io"
@@ -32,7 +33,7 @@ import (
 func TestIntegrationCachedBlobChecker(t *testing.T) {
 	t.Parallel()
 	bucket := awsRegionToHostURL("us-east-1", "")
-	blobs := newCachedBlobChecker()
+	blobs := newCachedBlobChecker(RegistryConfig{})
 	testCases := []struct {
 		Name         string
 		BlobURL      string
@@ -69,7 +70,7 @@ func TestIntegrationCachedBlobChecker(t *testing.T) {
 		tc := testCases[i]
 		t.Run(tc.Name, func(t *testing.T) {
 			url := tc.BlobURL
-			exists := blobs.BlobExists(url)
+			exists, _ := blobs.BlobExists(context.Background(), url)
 			if exists != tc.ExpectExists {
 				t.Fatalf("expected: %v but got: %v", tc.ExpectExists, exists)
 			}
@@ -79,7 +80,7 @@ func TestIntegrationCachedBlobChecker(t *testing.T) {
 		tc := testCases[i]
 		t.Run(tc.Name, func(t *testing.T) {
 			url := tc.BlobURL
-			exists := blobs.BlobExists(url)
+			exists, _ := blobs.BlobExists(context.Background(), url)
 			if exists != tc.ExpectExists {
 				t.Fatalf("expected: %v but got: %v", tc.ExpectExists, exists)
 			}
@@ -17,8 +17,23 @@ limitations under the License.
 package app
 
 import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 
 	"k8s.io/registry.k8s.io/pkg/net/cloudcidrs"
 )
@@ -47,11 +62,929 @@ func TestRegionToAWSRegionToHostURL(t *testing.T) {
 
 func TestBlobCache(t *testing.T) {
 	bc := &blobCache{}
-	bc.Put("foo")
-	if !bc.Get("foo") {
+	created := time.Now()
+	bc.Put("foo", blobCacheEntry{created: created})
+	if entry, exists := bc.Get("foo"); !exists || !entry.created.Equal(created) {
 		t.Fatal("Cache did not contain key we just put")
 	}
-	if bc.Get("bar") {
+	if _, exists := bc.Get("bar"); exists {
 		t.Fatal("Cache contained key we did not put")
 	}
+	bc.Delete("foo")
+	if _, exists := bc.Get("foo"); exists {
+		t.Fatal("Cache contained key we deleted")
+	}
+}
+
+func TestKnownBuckets(t *testing.T) {
+	buckets := knownBuckets()
+	seen := map[string]bool{}
+	for _, b := range buckets {
+		if b.url == "" {
+			t.Fatalf("received empty URL for bucket in region %q", b.region)
+		}
+		if seen[b.url] {
+			t.Fatalf("received duplicate bucket URL %q", b.url)
+		}
+		seen[b.url] = true
+	}
+	if !seen[awsRegionToHostURL("us-east-1", "")] {
+		t.Fatal("expected us-east-1 bucket to be known")
+	}
+}
+
+func TestAlternateBucketURLs(t *testing.T) {
+	buckets := []bucket{
+		{region: "eu-central-1", url: "https://eu-central-1.example"},
+		{region: "eu-west-1", url: "https://eu-west-1.example"},
+		{region: "eu-west-3", url: "https://eu-west-3.example"},
+		{region: "us-east-1", url: "https://us-east-1.example"},
+	}
+	testCases := []struct {
+		Name       string
+		Region     string
+		BucketURL  string
+		Limit      int
+		Alternates []string
+	}{
+		{
+			Name:       "disabled",
+			Region:     "eu-west-3",
+			BucketURL:  "https://eu-west-3.example",
+			Limit:      0,
+			Alternates: nil,
+		},
+		{
+			Name:       "negative",
+			Region:     "eu-west-3",
+			BucketURL:  "https://eu-west-3.example",
+			Limit:      -1,
+			Alternates: nil,
+		},
+		{
+			Name:       "same geography first",
+			Region:     "eu-west-3",
+			BucketURL:  "https://eu-west-3.example",
+			Limit:      2,
+			Alternates: []string{"https://eu-central-1.example", "https://eu-west-1.example"},
+		},
+		{
+			Name:       "other geographies after",
+			Region:     "eu-west-3",
+			BucketURL:  "https://eu-west-3.example",
+			Limit:      10,
+			Alternates: []string{"https://eu-central-1.example", "https://eu-west-1.example", "https://us-east-1.example"},
+		},
+		{
+			Name:       "unknown region",
+			Region:     "",
+			BucketURL:  "https://us-east-1.example",
+			Limit:      1,
+			Alternates: []string{"https://eu-central-1.example"},
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			alternates := alternateBucketURLs(buckets, tc.Region, tc.BucketURL, tc.Limit)
+			if !reflect.DeepEqual(alternates, tc.Alternates) {
+				t.Fatalf("expected alternates: %v, but got: %v", tc.Alternates, alternates)
+			}
+		})
+	}
+}
+
+// newFakeProbeBackend returns a backend that responds to every request with
+// the status code currently stored in status
+func newFakeProbeBackend(t *testing.T, status *atomic.Int32) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(int(status.Load()))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCostAwareBucketURLs(t *testing.T) {
+	buckets := []bucket{
+		{region: "eu-central-1", url: "https://eu-central-1.example"},
+		{region: "eu-north-1", url: "https://eu-north-1.example"},
+		{region: "eu-west-1", url: "https://eu-west-1.example"},
+		{region: "eu-west-3", url: "https://eu-west-3.example"},
+		{region: "us-east-1", url: "https://us-east-1.example"},
+	}
+	costPerGB := map[string]float64{
+		"eu-central-1": 0.05,
+		"eu-west-1":    0.09,
+		"eu-west-3":    0.02,
+		"us-east-1":    0.01,
+	}
+	testCases := []struct {
+		Name       string
+		CostWeight float64
+		CostPerGB  map[string]float64
+		Expected   []string
+	}{
+		{
+			Name:       "proximity only",
+			CostWeight: 0,
+			CostPerGB:  costPerGB,
+			Expected: []string{
+				"https://eu-west-1.example",
+				"https://eu-west-3.example",
+				"https://eu-central-1.example",
+				"https://eu-north-1.example",
+			},
+		},
+		{
+			Name:       "balanced prefers cheaper bucket in the same area",
+			CostWeight: 0.5,
+			CostPerGB:  costPerGB,
+			Expected: []string{
+				"https://eu-west-3.example",
+				"https://eu-west-1.example",
+				"https://eu-central-1.example",
+				"https://eu-north-1.example",
+			},
+		},
+		{
+			Name:       "balanced keeps the usual bucket over other areas",
+			CostWeight: 0.5,
+			CostPerGB:  map[string]float64{"eu-central-1": 0.01, "eu-west-1": 0.09, "eu-west-3": 0.09},
+			Expected: []string{
+				"https://eu-west-1.example",
+				"https://eu-central-1.example",
+				"https://eu-west-3.example",
+				"https://eu-north-1.example",
+			},
+		},
+		{
+			Name:       "mostly cost prefers cheaper buckets",
+			CostWeight: 0.9,
+			CostPerGB:  costPerGB,
+			Expected: []string{
+				"https://eu-west-3.example",
+				"https://eu-central-1.example",
+				"https://eu-west-1.example",
+				"https://eu-north-1.example",
+			},
+		},
+		{
+			Name:       "no costs configured",
+			CostWeight: 1,
+			Expected: []string{
+				"https://eu-west-1.example",
+				"https://eu-central-1.example",
+				"https://eu-north-1.example",
+				"https://eu-west-3.example",
+			},
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			candidates := costAwareBucketURLs(buckets, "eu-west-1", "https://eu-west-1.example", "sha256:a", tc.CostPerGB, tc.CostWeight, TieBreakOrder)
+			if !reflect.DeepEqual(candidates, tc.Expected) {
+				t.Fatalf("expected candidates: %v, but got: %v", tc.Expected, candidates)
+			}
+		})
+	}
+}
+
+func TestValidateBlobAlternateLinks(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		Name        string
+		Limit       int
+		ExpectError bool
+	}{
+		{
+			Name: "disabled",
+		},
+		{
+			Name:  "limited",
+			Limit: 3,
+		},
+		{
+			Name:        "negative",
+			Limit:       -1,
+			ExpectError: true,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			err := ValidateBlobAlternateLinks(tc.Limit)
+			if tc.ExpectError && err == nil {
+				t.Fatal("expected error but got none")
+			} else if !tc.ExpectError && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateCostWeight(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		Name        string
+		CostWeight  float64
+		ExpectError bool
+	}{
+		{
+			Name: "proximity only",
+		},
+		{
+			Name:       "default",
+			CostWeight: 0.5,
+		},
+		{
+			Name:       "cost only",
+			CostWeight: 1,
+		},
+		{
+			Name:        "negative",
+			CostWeight:  -0.1,
+			ExpectError: true,
+		},
+		{
+			Name:        "above one",
+			CostWeight:  1.5,
+			ExpectError: true,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			err := ValidateCostWeight(tc.CostWeight)
+			if tc.ExpectError && err == nil {
+				t.Fatal("expected error but got none")
+			} else if !tc.ExpectError && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestRegionArea(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		Region   string
+		Expected string
+	}{
+		{Region: "eu-west-1", Expected: "eu-west"},
+		{Region: "eu-west-3", Expected: "eu-west"},
+		{Region: "us-gov-west-1", Expected: "us-gov-west"},
+		{Region: "unknown", Expected: "unknown"},
+	}
+	for _, tc := range testCases {
+		if area := regionArea(tc.Region); area != tc.Expected {
+			t.Fatalf("expected area of %q: %q, but got: %q", tc.Region, tc.Expected, area)
+		}
+	}
+}
+
+func TestCostAwareBucketURLsTieBreaker(t *testing.T) {
+	t.Parallel()
+	buckets := []bucket{
+		{region: "eu-central-1", url: "https://eu-central-1.example"},
+		{region: "eu-north-1", url: "https://eu-north-1.example"},
+		{region: "eu-west-1", url: "https://eu-west-1.example"},
+		{region: "eu-west-3", url: "https://eu-west-3.example"},
+	}
+	// with only cost weighted and no costs configured every bucket ties
+	candidates := func(digest, tieBreaker string) []string {
+		return costAwareBucketURLs(buckets, "eu-west-1", "https://eu-west-1.example", digest, nil, 1, tieBreaker)
+	}
+	// by default ties are in order regardless of digest
+	expected := []string{
+		"https://eu-west-1.example",
+		"https://eu-central-1.example",
+		"https://eu-north-1.example",
+		"https://eu-west-3.example",
+	}
+	for _, digest := range []string{"sha256:a", "sha256:b"} {
+		if actual := candidates(digest, TieBreakOrder); !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("expected candidates: %v, but got: %v", expected, actual)
+		}
+	}
+	// by digest ties are deterministic per digest, but spread across buckets
+	preferred := map[string]int{}
+	for i := 0; i < 100; i++ {
+		digest := fmt.Sprintf("sha256:%d", i)
+		first := candidates(digest, TieBreakDigest)
+		if again := candidates(digest, TieBreakDigest); !reflect.DeepEqual(first, again) {
+			t.Fatalf("expected consistent candidates for %s: %v, but got: %v", digest, first, again)
+		}
+		if len(first) != len(buckets) {
+			t.Fatalf("expected %d candidates, but got: %v", len(buckets), first)
+		}
+		preferred[first[0]]++
+	}
+	for _, b := range buckets {
+		if preferred[b.url] == 0 {
+			t.Fatalf("expected some digests to prefer %s, got: %v", b.url, preferred)
+		}
+	}
+	// but ties never override a better score
+	costPerGB := map[string]float64{"eu-west-3": 0.01, "eu-west-1": 0.09}
+	for i := 0; i < 100; i++ {
+		actual := costAwareBucketURLs(buckets, "eu-west-1", "https://eu-west-1.example", fmt.Sprintf("sha256:%d", i), costPerGB, 1, TieBreakDigest)
+		if actual[0] != "https://eu-west-3.example" {
+			t.Fatalf("expected cheapest bucket first, but got: %v", actual)
+		}
+	}
+}
+
+func TestCachedBlobCheckerBlobSize(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sized", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Length", "1234")
+	})
+	mux.HandleFunc("/unsized", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	backend := httptest.NewServer(mux)
+	t.Cleanup(backend.Close)
+	blobs := newCachedBlobChecker(RegistryConfig{})
+
+	if _, known := blobs.BlobSize(backend.URL + "/sized"); known {
+		t.Fatal("expected size of unprobed blob to be unknown")
+	}
+	if exists, _ := blobs.BlobExists(context.Background(), backend.URL+"/sized"); !exists {
+		t.Fatal("expected blob to exist")
+	}
+	if size, known := blobs.BlobSize(backend.URL + "/sized"); !known || size != 1234 {
+		t.Fatalf("expected size 1234, but got: %d, %t", size, known)
+	}
+	if exists, _ := blobs.BlobExists(context.Background(), backend.URL+"/unsized"); !exists {
+		t.Fatal("expected blob to exist")
+	}
+	if _, known := blobs.BlobSize(backend.URL + "/unsized"); known {
+		t.Fatal("expected size of blob without Content-Length to be unknown")
+	}
+}
+
+func TestCachedBlobCheckerMinSize(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/small", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Length", "100")
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Length", "1000")
+	})
+	mux.HandleFunc("/unsized", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	backend := httptest.NewServer(mux)
+	t.Cleanup(backend.Close)
+	blobs := newCachedBlobChecker(RegistryConfig{BlobCacheMinSize: 1000})
+
+	for _, path := range []string{"/small", "/large", "/unsized"} {
+		if exists, _ := blobs.BlobExists(context.Background(), backend.URL+path); !exists {
+			t.Fatalf("expected %s to exist", path)
+		}
+	}
+	if _, cached := blobs.Get(backend.URL + "/small"); cached {
+		t.Fatal("expected small blob not to be cached")
+	}
+	// so egress headers are not set for it
+	if _, known := blobs.BlobSize(backend.URL + "/small"); known {
+		t.Fatal("expected small blob size not to be known")
+	}
+	if _, cached := blobs.Get(backend.URL + "/large"); !cached {
+		t.Fatal("expected large blob to be cached")
+	}
+	if _, cached := blobs.Get(backend.URL + "/unsized"); !cached {
+		t.Fatal("expected blob of unknown size to be cached")
+	}
+}
+
+func TestCachedBlobCheckerVerifyETag(t *testing.T) {
+	const digest = "sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	etag := &atomic.Value{}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/data") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", `"`+etag.Load().(string)+`"`)
+	}))
+	t.Cleanup(backend.Close)
+	rc := RegistryConfig{
+		VerifyBlobETag: true,
+		Backends: map[string]BackendConfig{
+			backend.URL: {KeySuffix: "/data"},
+		},
+	}
+	blobs := newCachedBlobChecker(rc)
+
+	before := testutil.ToFloat64(blobETagMismatchTotal)
+	etag.Store(digest)
+	if exists, _ := blobs.BlobExists(context.Background(), bucketBlobURL(rc, backend.URL, digest)); !exists {
+		t.Fatal("expected blob with matching ETag to exist")
+	}
+	if mismatches := testutil.ToFloat64(blobETagMismatchTotal) - before; mismatches != 0 {
+		t.Fatalf("expected no mismatches for matching ETag, got: %v", mismatches)
+	}
+	// mismatches are reported, but the blob is still served
+	blobs.blobCache.Delete(bucketBlobURL(rc, backend.URL, digest))
+	etag.Store("sha256:0000000000000000000000000000000000000000000000000000000000000000")
+	if exists, _ := blobs.BlobExists(context.Background(), bucketBlobURL(rc, backend.URL, digest)); !exists {
+		t.Fatal("expected blob with mismatching ETag to exist")
+	}
+	if mismatches := testutil.ToFloat64(blobETagMismatchTotal) - before; mismatches != 1 {
+		t.Fatalf("expected 1 mismatch for mismatching ETag, got: %v", mismatches)
+	}
+}
+
+func TestCheckBlobETag(t *testing.T) {
+	const blobURL = "https://example.com/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	testCases := []struct {
+		Name      string
+		BlobURL   string
+		KeySuffix string
+		ETag      string
+		Expected  bool
+	}{
+		{
+			Name:     "matching digest",
+			BlobURL:  blobURL,
+			ETag:     `"sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"`,
+			Expected: true,
+		},
+		{
+			Name:      "matching bare hash with query key suffix",
+			BlobURL:   blobURL + "?versionId=1",
+			KeySuffix: "?versionId=1",
+			ETag:      `W/"DA86E6BA6CA197BF6BC5E9D900FEBD906B133EAA4750E6BED647B0FBE50ED43E"`,
+			Expected:  true,
+		},
+		{
+			Name:      "matching digest with path key suffix",
+			BlobURL:   blobURL + "/data",
+			KeySuffix: "/data",
+			ETag:      `"sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"`,
+			Expected:  true,
+		},
+		{
+			Name:      "mismatching digest with path key suffix",
+			BlobURL:   blobURL + "/data",
+			KeySuffix: "/data",
+			ETag:      `"sha256:0000000000000000000000000000000000000000000000000000000000000000"`,
+			Expected:  false,
+		},
+		{
+			Name:     "mismatching digest",
+			BlobURL:  blobURL,
+			ETag:     `"sha256:0000000000000000000000000000000000000000000000000000000000000000"`,
+			Expected: false,
+		},
+		{
+			Name:     "mismatching bare hash",
+			BlobURL:  blobURL,
+			ETag:     `"0000000000000000000000000000000000000000000000000000000000000000"`,
+			Expected: false,
+		},
+		{
+			Name:     "S3 MD5 ETag is ignored",
+			BlobURL:  blobURL,
+			ETag:     `"d41d8cd98f00b204e9800998ecf8427e"`,
+			Expected: true,
+		},
+		{
+			Name:     "no ETag",
+			BlobURL:  blobURL,
+			Expected: true,
+		},
+		{
+			Name:     "not a blob URL",
+			BlobURL:  "https://example.com/layer",
+			ETag:     `"sha256:0000000000000000000000000000000000000000000000000000000000000000"`,
+			Expected: true,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			if actual := checkBlobETag(tc.BlobURL, tc.KeySuffix, tc.ETag); actual != tc.Expected {
+				t.Fatalf("expected: %t, but got: %t", tc.Expected, actual)
+			}
+		})
+	}
+}
+
+func TestCachedBlobCheckerDisabled(t *testing.T) {
+	status := &atomic.Int32{}
+	probes := &atomic.Int32{}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		probes.Add(1)
+		w.WriteHeader(int(status.Load()))
+	}))
+	t.Cleanup(backend.Close)
+	blobURL := backend.URL + "/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	blobs := newCachedBlobChecker(RegistryConfig{DisableBlobCache: true, ServeStaleOnError: true})
+
+	status.Store(http.StatusOK)
+	for i := 0; i < 3; i++ {
+		if exists, _ := blobs.BlobExists(context.Background(), blobURL); !exists {
+			t.Fatal("expected blob to exist")
+		}
+	}
+	if actual := probes.Load(); actual != 3 {
+		t.Fatalf("expected every request to probe, got %d probes", actual)
+	}
+	if blobs.Len() != 0 {
+		t.Fatalf("expected nothing to be cached, got %d entries", blobs.Len())
+	}
+	// so egress headers are not set
+	if _, known := blobs.BlobSize(blobURL); known {
+		t.Fatal("expected blob size not to be known")
+	}
+	// nothing to fall back to either
+	status.Store(http.StatusNotFound)
+	if exists, err := blobs.BlobExists(context.Background(), blobURL); exists || err != nil {
+		t.Fatalf("expected blob not to exist, got exists: %t, err: %v", exists, err)
+	}
+	status.Store(http.StatusInternalServerError)
+	if exists, err := blobs.BlobExists(context.Background(), blobURL); exists || err == nil {
+		t.Fatalf("expected an error, got exists: %t, err: %v", exists, err)
+	}
+}
+
+func TestCachedBlobCheckerProbeRootCAs(t *testing.T) {
+	// served with a certificate from a CA the system does not trust
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(backend.Close)
+	blobURL := backend.URL + "/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+
+	if exists, _ := newCachedBlobChecker(RegistryConfig{}).BlobExists(context.Background(), blobURL); exists {
+		t.Fatal("expected probe to fail verification without the CA")
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(backend.Certificate())
+	if exists, _ := newCachedBlobChecker(RegistryConfig{ProbeRootCAs: pool}).BlobExists(context.Background(), blobURL); !exists {
+		t.Fatal("expected probe to succeed with the CA")
+	}
+}
+
+func TestCachedBlobCheckerForbidden(t *testing.T) {
+	testCases := []struct {
+		Name                string
+		Status              int32
+		ForbiddenBlobExists bool
+		ExpectedExists      bool
+		ExpectError         bool
+		ExpectedResult      string
+	}{
+		{
+			Name:           "404 is absent",
+			Status:         http.StatusNotFound,
+			ExpectedExists: false,
+			ExpectedResult: probeResultNotFound,
+		},
+		{
+			Name:                "404 is absent even if 403 is present",
+			Status:              http.StatusNotFound,
+			ForbiddenBlobExists: true,
+			ExpectedExists:      false,
+			ExpectedResult:      probeResultNotFound,
+		},
+		{
+			Name:           "403 is absent by default",
+			Status:         http.StatusForbidden,
+			ExpectedExists: false,
+			ExpectedResult: probeResultForbidden,
+		},
+		{
+			Name:                "403 is present if configured",
+			Status:              http.StatusForbidden,
+			ForbiddenBlobExists: true,
+			ExpectedExists:      true,
+			ExpectedResult:      probeResultForbidden,
+		},
+		{
+			Name:           "200 is present",
+			Status:         http.StatusOK,
+			ExpectedExists: true,
+			ExpectedResult: probeResultFound,
+		},
+		{
+			Name:           "500 is an error",
+			Status:         http.StatusInternalServerError,
+			ExpectedExists: false,
+			ExpectError:    true,
+			ExpectedResult: probeResultError,
+		},
+	}
+	for _, tc := range testCases {
+		// NOTE: not parallel, as we check global metrics
+		t.Run(tc.Name, func(t *testing.T) {
+			status := &atomic.Int32{}
+			status.Store(tc.Status)
+			backend := newFakeProbeBackend(t, status)
+			blobs := newCachedBlobChecker(RegistryConfig{ForbiddenBlobExists: tc.ForbiddenBlobExists})
+			counter := blobProbeResultsTotal.WithLabelValues(tc.ExpectedResult)
+			before := testutil.ToFloat64(counter)
+			exists, err := blobs.BlobExists(context.Background(), backend.URL+"/containers/images/sha256:abc")
+			if exists != tc.ExpectedExists {
+				t.Fatalf("expected exists: %t, but got: %t", tc.ExpectedExists, exists)
+			}
+			if (err != nil) != tc.ExpectError {
+				t.Fatalf("expected error: %t, but got: %v", tc.ExpectError, err)
+			}
+			if counted := testutil.ToFloat64(counter) - before; counted != 1 {
+				t.Fatalf("expected 1 %s probe result, got: %v", tc.ExpectedResult, counted)
+			}
+		})
+	}
+}
+
+func TestCachedBlobCheckerTTL(t *testing.T) {
+	status := &atomic.Int32{}
+	backend := newFakeProbeBackend(t, status)
+	blobURL := backend.URL + "/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	now := time.Now()
+	blobs := newCachedBlobChecker(RegistryConfig{BlobCacheTTL: time.Minute})
+	blobs.now = func() time.Time { return now }
+
+	status.Store(http.StatusOK)
+	if exists, _ := blobs.BlobExists(context.Background(), blobURL); !exists {
+		t.Fatal("expected blob to exist")
+	}
+	// cached, so we should not care what the backend says now
+	status.Store(http.StatusNotFound)
+	if exists, _ := blobs.BlobExists(context.Background(), blobURL); !exists {
+		t.Fatal("expected cached blob to exist")
+	}
+	// expired, so we should probe again and find it is gone
+	now = now.Add(2 * time.Minute)
+	if exists, _ := blobs.BlobExists(context.Background(), blobURL); exists {
+		t.Fatal("expected expired blob to be re-probed and not exist")
+	}
+	if _, cached := blobs.blobCache.Get(blobURL); cached {
+		t.Fatal("expected missing blob to be removed from the cache")
+	}
+}
+
+func TestCachedBlobCheckerServeStaleOnError(t *testing.T) {
+	testCases := []struct {
+		Name              string
+		ServeStaleOnError bool
+		ProbeStatus       int
+		ExpectExists      bool
+		ExpectError       bool
+		ExpectStaleServed bool
+	}{
+		{
+			Name:              "serve stale, backend error",
+			ServeStaleOnError: true,
+			ProbeStatus:       http.StatusServiceUnavailable,
+			ExpectExists:      true,
+			ExpectStaleServed: true,
+		},
+		{
+			Name:              "serve stale, blob gone",
+			ServeStaleOnError: true,
+			ProbeStatus:       http.StatusNotFound,
+			ExpectExists:      false,
+		},
+		{
+			Name:              "do not serve stale, backend error",
+			ServeStaleOnError: false,
+			ProbeStatus:       http.StatusServiceUnavailable,
+			ExpectExists:      false,
+			ExpectError:       true,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		// NOTE: not parallel, we're checking a global metric
+		t.Run(tc.Name, func(t *testing.T) {
+			status := &atomic.Int32{}
+			backend := newFakeProbeBackend(t, status)
+			blobURL := backend.URL + "/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+			now := time.Now()
+			blobs := newCachedBlobChecker(RegistryConfig{
+				BlobCacheTTL:      time.Minute,
+				ServeStaleOnError: tc.ServeStaleOnError,
+			})
+			blobs.now = func() time.Time { return now }
+			status.Store(http.StatusOK)
+			if exists, _ := blobs.BlobExists(context.Background(), blobURL); !exists {
+				t.Fatal("expected blob to exist")
+			}
+
+			now = now.Add(2 * time.Minute)
+			status.Store(int32(tc.ProbeStatus))
+			staleServedBefore := testutil.ToFloat64(blobCacheStaleServedTotal)
+			exists, err := blobs.BlobExists(context.Background(), blobURL)
+			if exists != tc.ExpectExists {
+				t.Fatalf("expected exists: %t, but got: %t", tc.ExpectExists, exists)
+			}
+			if (err != nil) != tc.ExpectError {
+				t.Fatalf("expected error: %t, but got: %v", tc.ExpectError, err)
+			}
+			staleServed := testutil.ToFloat64(blobCacheStaleServedTotal) - staleServedBefore
+			if expected := map[bool]float64{true: 1, false: 0}[tc.ExpectStaleServed]; staleServed != expected {
+				t.Fatalf("expected %v stale served responses to be counted, got: %v", expected, staleServed)
+			}
+		})
+	}
+}
+
+// concurrencyTrackingBackend is a backend recording the most concurrent
+// requests it has seen, which block until release is closed
+type concurrencyTrackingBackend struct {
+	*httptest.Server
+	// arrived receives once per request, as it starts blocking
+	arrived     chan struct{}
+	release     chan struct{}
+	maxInFlight atomic.Int32
+}
+
+func newConcurrencyTrackingBackend(t *testing.T, release chan struct{}) *concurrencyTrackingBackend {
+	b := &concurrencyTrackingBackend{
+		arrived: make(chan struct{}, 100),
+		release: release,
+	}
+	inFlight := &atomic.Int32{}
+	b.Server = httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			seen := b.maxInFlight.Load()
+			if current <= seen || b.maxInFlight.CompareAndSwap(seen, current) {
+				break
+			}
+		}
+		b.arrived <- struct{}{}
+		<-b.release
+	}))
+	t.Cleanup(b.Server.Close)
+	return b
+}
+
+// waitArrived waits for n requests to be blocking in the backend
+func (b *concurrencyTrackingBackend) waitArrived(n int) {
+	for i := 0; i < n; i++ {
+		<-b.arrived
+	}
+}
+
+func TestCachedBlobCheckerMaxConcurrentProbes(t *testing.T) {
+	t.Parallel()
+	release := make(chan struct{})
+	small := newConcurrencyTrackingBackend(t, release)
+	large := newConcurrencyTrackingBackend(t, release)
+	unlimited := newConcurrencyTrackingBackend(t, release)
+	blobs := newCachedBlobChecker(RegistryConfig{
+		Backends: map[string]BackendConfig{
+			small.URL: {MaxConcurrentProbes: 1},
+			large.URL: {MaxConcurrentProbes: 3},
+		},
+	})
+	// queued probes must wait for the whole test, not time out
+	blobs.probeSlotTimeout = time.Hour
+	const probesPerBackend = 6
+	var wg sync.WaitGroup
+	for _, bucketURL := range []string{small.URL, large.URL, unlimited.URL} {
+		for i := 0; i < probesPerBackend; i++ {
+			// distinct blobs, so that each is probed
+			blobURL := bucketURL + blobPathPrefix + "sha256:" + strconv.Itoa(i)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if exists, _ := blobs.BlobExists(context.Background(), blobURL); !exists {
+					t.Errorf("expected %q to exist", blobURL)
+				}
+			}()
+		}
+	}
+	// hold every probe in the backends until each reaches its limit
+	small.waitArrived(1)
+	large.waitArrived(3)
+	unlimited.waitArrived(probesPerBackend)
+	close(release)
+	wg.Wait()
+	if got := small.maxInFlight.Load(); got != 1 {
+		t.Fatalf("expected at most 1 concurrent probe to small backend, got: %d", got)
+	}
+	if got := large.maxInFlight.Load(); got != 3 {
+		t.Fatalf("expected at most 3 concurrent probes to large backend, got: %d", got)
+	}
+	if got := unlimited.maxInFlight.Load(); got != probesPerBackend {
+		t.Fatalf("expected %d concurrent probes to unlimited backend, got: %d", probesPerBackend, got)
+	}
+}
+
+// NOTE: not parallel, we're checking a global metric
+func TestCachedBlobCheckerProbeSlotUnavailable(t *testing.T) {
+	release := make(chan struct{})
+	backend := newConcurrencyTrackingBackend(t, release)
+	blobURL := backend.URL + "/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	blobs := newCachedBlobChecker(RegistryConfig{
+		Backends: map[string]BackendConfig{
+			backend.URL: {MaxConcurrentProbes: 1},
+		},
+		BlobCacheTTL:      time.Minute,
+		ServeStaleOnError: true,
+	})
+	// hold the only slot
+	held := make(chan bool)
+	go func() {
+		exists, _ := blobs.BlobExists(context.Background(), blobURL+"0")
+		held <- exists
+	}()
+	backend.waitArrived(1)
+
+	before := testutil.ToFloat64(probeSlotsExhaustedTotal)
+	// waiting for the slot times out
+	blobs.probeSlotTimeout = time.Millisecond
+	if exists, err := blobs.BlobExists(context.Background(), blobURL); exists || !errors.Is(err, errProbeSlotUnavailable) {
+		t.Fatalf("expected an error without a free probe slot, got exists: %t, err: %v", exists, err)
+	}
+	// or stops once the request is gone
+	blobs.probeSlotTimeout = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	blobs.disabled = true
+	if exists, err := blobs.BlobExists(ctx, blobURL); exists || !errors.Is(err, errProbeSlotUnavailable) {
+		t.Fatalf("expected an error for a cancelled request, got exists: %t, err: %v", exists, err)
+	}
+	blobs.disabled = false
+	// a stale entry is still better than nothing
+	now := time.Now()
+	blobs.now = func() time.Time { return now }
+	blobs.blobCache.Put(blobURL, blobCacheEntry{created: now.Add(-2 * time.Minute), size: -1})
+	if exists, _ := blobs.BlobExists(ctx, blobURL); !exists {
+		t.Fatal("expected stale blob to be served without a free probe slot")
+	}
+	if exhausted := testutil.ToFloat64(probeSlotsExhaustedTotal) - before; exhausted != 3 {
+		t.Fatalf("expected 3 exhausted probe slots to be counted, got: %v", exhausted)
+	}
+
+	close(release)
+	if !<-held {
+		t.Fatal("expected blob holding the slot to exist")
+	}
+}
+
+// histogramSnapshot returns the current sample count and sum of h
+func histogramSnapshot(t *testing.T, h prometheus.Histogram) (uint64, float64) {
+	t.Helper()
+	m := &dto.Metric{}
+	if err := h.Write(m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+}
+
+// NOTE: not parallel, we're checking a global metric
+func TestCachedBlobCheckerEntryAge(t *testing.T) {
+	status := &atomic.Int32{}
+	status.Store(http.StatusOK)
+	backend := newFakeProbeBackend(t, status)
+	blobURL := backend.URL + "/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	now := time.Now()
+	blobs := newCachedBlobChecker(RegistryConfig{})
+	blobs.now = func() time.Time { return now }
+
+	countBefore, sumBefore := histogramSnapshot(t, blobCacheEntryAgeSeconds)
+	// a miss is not served from the cache, so no age is recorded
+	if exists, _ := blobs.BlobExists(context.Background(), blobURL); !exists {
+		t.Fatal("expected blob to exist")
+	}
+	if count, _ := histogramSnapshot(t, blobCacheEntryAgeSeconds); count != countBefore {
+		t.Fatalf("expected no ages recorded for a cache miss, got: %d", count-countBefore)
+	}
+	// fresh entry
+	if exists, _ := blobs.BlobExists(context.Background(), blobURL); !exists {
+		t.Fatal("expected blob to exist")
+	}
+	// older entry
+	now = now.Add(time.Hour)
+	if exists, _ := blobs.BlobExists(context.Background(), blobURL); !exists {
+		t.Fatal("expected blob to exist")
+	}
+	count, sum := histogramSnapshot(t, blobCacheEntryAgeSeconds)
+	if count-countBefore != 2 {
+		t.Fatalf("expected 2 ages recorded, got: %d", count-countBefore)
+	}
+	if recorded := sum - sumBefore; recorded != time.Hour.Seconds() {
+		t.Fatalf("expected recorded ages to sum to %v, got: %v", time.Hour.Seconds(), recorded)
+	}
+}
+
+func TestCachedBlobCheckerUnreachable(t *testing.T) {
+	blobs := newCachedBlobChecker(RegistryConfig{})
+	if exists, err := blobs.BlobExists(context.Background(), "http://127.0.0.1:0/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"); exists || err == nil {
+		t.Fatalf("expected an error for an unreachable blob, got exists: %t, err: %v", exists, err)
+	}
 }
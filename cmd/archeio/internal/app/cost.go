@@ -0,0 +1,72 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"net/http"
+	"net/netip"
+	"strconv"
+)
+
+const (
+	// egressBytesHeader reports the size of the blob being served
+	egressBytesHeader = "X-Estimated-Egress-Bytes"
+	// egressCostHeader reports the estimated cost of serving the blob in USD
+	egressCostHeader = "X-Estimated-Egress-Cost"
+	// bytesPerGB matches AWS billing, which uses binary gigabytes
+	bytesPerGB = 1 << 30
+)
+
+// egressCostTrusted returns true if clientIP should get egress cost headers
+func egressCostTrusted(rc RegistryConfig, clientIP netip.Addr) bool {
+	if !rc.EgressCostHeaders {
+		return false
+	}
+	for _, prefix := range rc.EgressCostTrustedCIDRs {
+		if prefix.Contains(clientIP) {
+			return true
+		}
+	}
+	return false
+}
+
+// setEgressCostHeaders sets estimated egress headers for serving blobURL
+// from a bucket in bucketRegion, if the blob size is known
+//
+// The size is only known from cached existence probes, so these are not set
+// with DisableBlobCache or for blobs smaller than BlobCacheMinSize.
+func setEgressCostHeaders(w http.ResponseWriter, rc RegistryConfig, blobs blobChecker, bucketRegion, blobURL string) {
+	sizer, ok := blobs.(blobSizer)
+	if !ok {
+		return
+	}
+	size, known := sizer.BlobSize(blobURL)
+	if !known {
+		return
+	}
+	w.Header().Set(egressBytesHeader, strconv.FormatInt(size, 10))
+	if costPerGB, ok := rc.EgressCostPerGB[bucketRegion]; ok {
+		cost := float64(size) / bytesPerGB * costPerGB
+		w.Header().Set(egressCostHeader, strconv.FormatFloat(cost, 'f', 6, 64))
+	}
+}
+
+// clearEgressCostHeaders undoes setEgressCostHeaders
+func clearEgressCostHeaders(w http.ResponseWriter) {
+	w.Header().Del(egressBytesHeader)
+	w.Header().Del(egressCostHeader)
+}
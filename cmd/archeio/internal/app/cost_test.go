@@ -0,0 +1,187 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+// fakeSizedBlobsChecker is a fakeBlobsChecker that also knows blob sizes
+type fakeSizedBlobsChecker struct {
+	fakeBlobsChecker
+	sizes map[string]int64
+}
+
+func (f *fakeSizedBlobsChecker) BlobSize(blobURL string) (int64, bool) {
+	size, known := f.sizes[blobURL]
+	return size, known
+}
+
+func TestMakeV2HandlerEgressCostHeaders(t *testing.T) {
+	const blobPath = "/v2/pause/blobs/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	const euWest1BlobURL = "https://prod-registry-k8s-io-eu-west-1.s3.dualstack.eu-west-1.amazonaws.com/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	const euWest3BlobURL = "https://prod-registry-k8s-io-eu-west-3.s3.dualstack.eu-west-3.amazonaws.com/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	const usEast1BlobURL = "https://prod-registry-k8s-io-us-east-1.s3.dualstack.us-east-1.amazonaws.com/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	sizedBlobs := &fakeSizedBlobsChecker{
+		fakeBlobsChecker: fakeBlobsChecker{
+			knownURLs: map[string]bool{
+				euWest1BlobURL: true,
+				euWest3BlobURL: true,
+				usEast1BlobURL: true,
+			},
+		},
+		sizes: map[string]int64{
+			euWest1BlobURL: 2 << 30,
+			euWest3BlobURL: 1 << 30,
+		},
+	}
+	enabledConfig := RegistryConfig{
+		UpstreamRegistryEndpoint: "https://k8s.gcr.io",
+		ProxyBlobRegions:         []string{"eu-west-3"},
+		EgressCostHeaders:        true,
+		EgressCostTrustedCIDRs: []netip.Prefix{
+			netip.MustParsePrefix("52.0.0.0/8"),
+			netip.MustParsePrefix("35.180.0.0/16"),
+		},
+		EgressCostPerGB: map[string]float64{
+			"eu-west-1": 0.09,
+			"eu-west-3": 0.09,
+		},
+	}
+	testCases := []struct {
+		Name          string
+		Config        RegistryConfig
+		Blobs         blobChecker
+		Proxy         blobProxy
+		RemoteAddr    string
+		ExpectedBytes string
+		ExpectedCost  string
+	}{
+		{
+			Name:          "trusted client with region rate",
+			Config:        enabledConfig,
+			Blobs:         sizedBlobs,
+			RemoteAddr:    "52.208.1.1:888",
+			ExpectedBytes: "2147483648",
+			ExpectedCost:  "0.180000",
+		},
+		{
+			Name:          "trusted client proxied",
+			Config:        enabledConfig,
+			Blobs:         sizedBlobs,
+			Proxy:         &fakeBlobProxy{},
+			RemoteAddr:    "35.180.1.1:888",
+			ExpectedBytes: "1073741824",
+			ExpectedCost:  "0.090000",
+		},
+		{
+			Name: "trusted client served from a cheaper bucket",
+			Config: RegistryConfig{
+				UpstreamRegistryEndpoint: "https://k8s.gcr.io",
+				EgressCostHeaders:        true,
+				EgressCostTrustedCIDRs:   enabledConfig.EgressCostTrustedCIDRs,
+				EgressCostPerGB: map[string]float64{
+					"eu-west-1": 0.09,
+					"eu-west-3": 0.02,
+				},
+				CostAwareRouting: true,
+				CostWeight:       1,
+			},
+			Blobs: sizedBlobs,
+			// in eu-west-1, but served from eu-west-3 so priced there
+			RemoteAddr:    "52.208.1.1:888",
+			ExpectedBytes: "1073741824",
+			ExpectedCost:  "0.020000",
+		},
+		{
+			Name:       "trusted client proxy fails",
+			Config:     enabledConfig,
+			Blobs:      sizedBlobs,
+			Proxy:      &fakeBlobProxy{err: errors.New("backend unavailable")},
+			RemoteAddr: "35.180.1.1:888",
+		},
+		{
+			Name:       "trusted client unknown size",
+			Config:     enabledConfig,
+			Blobs:      sizedBlobs,
+			RemoteAddr: "52.93.127.172:888",
+		},
+		{
+			Name:       "trusted client checker without sizes",
+			Config:     enabledConfig,
+			Blobs:      &sizedBlobs.fakeBlobsChecker,
+			RemoteAddr: "52.208.1.1:888",
+		},
+		{
+			Name: "trusted client without region rate",
+			Config: RegistryConfig{
+				UpstreamRegistryEndpoint: "https://k8s.gcr.io",
+				EgressCostHeaders:        true,
+				EgressCostTrustedCIDRs:   enabledConfig.EgressCostTrustedCIDRs,
+			},
+			Blobs:         sizedBlobs,
+			RemoteAddr:    "52.208.1.1:888",
+			ExpectedBytes: "2147483648",
+		},
+		{
+			Name:       "untrusted client",
+			Config:     enabledConfig,
+			Blobs:      sizedBlobs,
+			RemoteAddr: "35.181.1.1:888",
+		},
+		{
+			Name: "disabled",
+			Config: RegistryConfig{
+				UpstreamRegistryEndpoint: "https://k8s.gcr.io",
+				EgressCostTrustedCIDRs:   enabledConfig.EgressCostTrustedCIDRs,
+				EgressCostPerGB:          enabledConfig.EgressCostPerGB,
+			},
+			Blobs:      sizedBlobs,
+			RemoteAddr: "52.208.1.1:888",
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			proxy := tc.Proxy
+			if proxy == nil {
+				proxy = &fakeBlobProxy{}
+			}
+			handler := makeV2Handler(context.Background(), tc.Config, tc.Blobs, proxy, nil, nil, nil)
+			r := httptest.NewRequest("GET", "http://localhost:8080"+blobPath, nil)
+			r.RemoteAddr = tc.RemoteAddr
+			recorder := httptest.NewRecorder()
+			handler(recorder, r)
+			response := recorder.Result()
+			if status := response.StatusCode; status != http.StatusOK && status != http.StatusTemporaryRedirect {
+				t.Fatalf("unexpected status: %d", status)
+			}
+			if egressBytes := response.Header.Get(egressBytesHeader); egressBytes != tc.ExpectedBytes {
+				t.Fatalf("expected %s: %q, but got: %q", egressBytesHeader, tc.ExpectedBytes, egressBytes)
+			}
+			if egressCost := response.Header.Get(egressCostHeader); egressCost != tc.ExpectedCost {
+				t.Fatalf("expected %s: %q, but got: %q", egressCostHeader, tc.ExpectedCost, egressCost)
+			}
+		})
+	}
+}
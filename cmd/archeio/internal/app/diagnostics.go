@@ -0,0 +1,83 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"runtime/debug"
+
+	"k8s.io/registry.k8s.io/pkg/net/cloudcidrs"
+)
+
+// diagnostics is the /admin/diagnostics support bundle
+type diagnostics struct {
+	// Config is the RegistryConfig, with secrets redacted
+	Config any `json:"config"`
+	// DataVersion identifies the embedded IP range data
+	DataVersion string `json:"dataVersion"`
+	// Regions is the number of known regions by cloud in the IP range data
+	Regions map[string]int `json:"regions"`
+	// Buckets maps AWS regions we have buckets in to the bucket URL
+	Buckets map[string]string `json:"buckets"`
+	Cache   cacheDiagnostics  `json:"cache"`
+	Build   buildDiagnostics  `json:"build"`
+}
+
+type cacheDiagnostics struct {
+	// BlobEntries is the number of blobs in the blob existence cache
+	BlobEntries int `json:"blobEntries"`
+}
+
+type buildDiagnostics struct {
+	GoVersion string `json:"goVersion"`
+	Version   string `json:"version"`
+	// Settings contains the build settings, e.g. vcs.revision
+	Settings map[string]string `json:"settings"`
+}
+
+// collectDiagnostics assembles a diagnostics bundle from current state
+func collectDiagnostics(rc RegistryConfig, cache *blobCache) diagnostics {
+	d := diagnostics{
+		Config:      rc.MarshalLog(),
+		DataVersion: cloudcidrs.DataVersion(),
+		Regions:     regionCounts(),
+		Buckets:     map[string]string{},
+		Cache: cacheDiagnostics{
+			BlobEntries: cache.Len(),
+		},
+	}
+	for _, b := range knownBuckets() {
+		d.Buckets[b.region] = b.url
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		d.Build.GoVersion = info.GoVersion
+		d.Build.Version = info.Main.Version
+		d.Build.Settings = make(map[string]string, len(info.Settings))
+		for _, setting := range info.Settings {
+			d.Build.Settings[setting.Key] = setting.Value
+		}
+	}
+	return d
+}
+
+// regionCounts returns the number of known regions by cloud in the IP range data
+func regionCounts() map[string]int {
+	counts := map[string]int{}
+	for _, ipInfo := range cloudcidrs.AllIPInfos() {
+		counts[ipInfo.Cloud]++
+	}
+	return counts
+}
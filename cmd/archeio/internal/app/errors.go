@@ -0,0 +1,52 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// OCI distribution spec error codes
+// https://github.com/opencontainers/distribution-spec/blob/main/spec.md#error-codes
+const (
+	errCodeDigestInvalid = "DIGEST_INVALID"
+	errCodeBlobUnknown   = "BLOB_UNKNOWN"
+	errCodeNameInvalid   = "NAME_INVALID"
+	// errCodeUnavailable is not in the OCI spec, but is what the reference
+	// distribution registry uses for 503 responses
+	errCodeUnavailable = "UNAVAILABLE"
+)
+
+type ociErrorResponse struct {
+	Errors []ociError `json:"errors"`
+}
+
+type ociError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// writeOCIError serves an OCI distribution spec error response
+func writeOCIError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	// errors writing here mean the client went away, there's nothing to do
+	_ = json.NewEncoder(w).Encode(ociErrorResponse{
+		Errors: []ociError{{Code: code, Message: message}},
+	})
+}
@@ -17,11 +17,19 @@ limitations under the License.
 package app
 
 import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"io"
 	"net/http"
+	"net/netip"
 	"path"
 	"regexp"
+	"slices"
 	"strings"
+	"time"
 
+	"golang.org/x/time/rate"
 	"k8s.io/klog/v2"
 
 	"k8s.io/registry.k8s.io/pkg/net/clientip"
@@ -34,6 +42,170 @@ type RegistryConfig struct {
 	InfoURL                  string
 	PrivacyURL               string
 	DefaultAWSBaseURL        string
+	// SelfRegion is the AWS region archeio is running in, if any, which is
+	// used to route clients whose region cannot be determined
+	SelfRegion string
+	// ProxyBlobRegions lists client regions for which blobs are streamed
+	// through archeio rather than redirecting to the bucket
+	ProxyBlobRegions []string
+	// ProxyBlobGzip enables gzip compressing proxied blobs for clients that
+	// accept it, unless the blob is already compressed
+	ProxyBlobGzip bool
+	// BlobAlternateLinks is the maximum number of alternate bucket URLs
+	// to advertise in Link headers on blob redirects, 0 disables this
+	BlobAlternateLinks int
+	// AdminToken enables the /admin/ debugging endpoints for requests
+	// with an "Authorization: Bearer $AdminToken" header
+	AdminToken string
+	// SlowRequestsLimit is how many of the slowest recent requests to
+	// keep for /admin/slowest
+	SlowRequestsLimit int
+	// BlobCacheTTL is how long to trust that a blob exists after probing,
+	// 0 means forever
+	BlobCacheTTL time.Duration
+	// ServeStaleOnError allows using expired blob cache entries when the
+	// backend cannot be probed
+	ServeStaleOnError bool
+	// DisableBlobCache probes blob existence on every request, for debugging
+	DisableBlobCache bool
+	// ProbeRootCAs are the root CAs trusted when probing backends for blobs,
+	// defaulting to the system roots if nil
+	ProbeRootCAs *x509.CertPool
+	// BlobCacheMinSize is the minimum blob size in bytes for existence
+	// checks to be cached, smaller blobs are probed on every request
+	BlobCacheMinSize int64
+	// ForbiddenBlobExists treats blob probes answered with 403 Forbidden as
+	// the blob existing, rather than as absent like 404
+	ForbiddenBlobExists bool
+	// VerifyBlobETag cross-checks backend ETags that look like a digest
+	// against the requested blob digest, reporting mismatches
+	VerifyBlobETag bool
+	// Backends contains optional configuration by bucket base URL
+	Backends map[string]BackendConfig
+	// RepeatedBlobRequestThreshold is how many identical blob requests
+	// a client may make within repeatedBlobRequestWindow before we flag it
+	// as not following redirects, 0 disables this
+	RepeatedBlobRequestThreshold int
+	// AllowedDigestAlgorithms lists the blob digest algorithms we serve,
+	// defaulting to defaultDigestAlgorithms if empty
+	AllowedDigestAlgorithms []string
+	// CostAwareRouting serves blobs from the cheapest bucket near the client
+	// by EgressCostPerGB, rather than always the client's usual bucket
+	CostAwareRouting bool
+	// CostWeight balances proximity (0) against cost (1) for CostAwareRouting
+	CostWeight float64
+	// CostTieBreaker orders buckets with equal CostAwareRouting scores,
+	// one of TieBreakOrder (the default if empty) or TieBreakDigest
+	CostTieBreaker string
+	// FallbackProbeRatio limits probes of buckets after the first candidate,
+	// e.g. from CostAwareRouting or ProtocolBackends, to about this fraction
+	// of blob lookups, 0 means no limit
+	FallbackProbeRatio float64
+	// DisableUpstreamBlobFallback serves 404 for blobs not found in AWS,
+	// instead of redirecting clients to the upstream registry for them
+	DisableUpstreamBlobFallback bool
+	// MaxForwardedForEntries bounds how many X-Forwarded-For entries are
+	// parsed to find the client IP, 0 means no limit
+	MaxForwardedForEntries int
+	// NeighborRegions maps client regions to nearby regions whose buckets
+	// we should probe in the background after serving a blob, so that the
+	// blob existence cache is warm for clients there
+	NeighborRegions map[string][]string
+	// NeighborWarmQPS is the maximum rate of background neighbor probes,
+	// 0 disables them
+	NeighborWarmQPS float64
+	// BackgroundPool runs short background tasks, such as neighbor probes,
+	// so they share its cap on goroutines. It may be shared by reloaded
+	// handlers, nil means each handler creates its own.
+	BackgroundPool *WorkerPool
+	// EgressCostHeaders enables estimated egress size and cost headers on
+	// blobs served from AWS to clients in EgressCostTrustedCIDRs
+	EgressCostHeaders      bool
+	EgressCostTrustedCIDRs []netip.Prefix
+	// EgressCostPerGB maps AWS regions to estimated egress cost in USD/GB
+	EgressCostPerGB map[string]float64
+	// ProtocolBackends maps TLS ALPN negotiated protocols (e.g. "h2") to a
+	// bucket base URL to try first for blobs, for experimenting with
+	// backends tuned for each protocol
+	ProtocolBackends map[string]string
+	// ErrorLogQPS limits the rate of error logs caused by requests,
+	// 0 means no limit
+	ErrorLogQPS float64
+	// RedirectStatusOverrides maps repository name prefixes to the status
+	// code for redirecting their API requests, 302 or 307 (the default),
+	// for clients that mishandle 307; the longest matching prefix wins
+	RedirectStatusOverrides map[string]int
+	// MaintenanceWarning is sent to clients in a Warning header on successful
+	// responses between MaintenanceStart and MaintenanceEnd, either of which
+	// may be zero to leave the window open, or "" to disable this
+	MaintenanceWarning string
+	MaintenanceStart   time.Time
+	MaintenanceEnd     time.Time
+	// RoutingLogFormat enables logging routing decisions to RoutingLogOutput
+	// in a stable schema, currently only RoutingLogFormatV1, or "" to disable
+	RoutingLogFormat string
+	// RoutingLogOutput is where routing decisions are logged, nil means stdout
+	RoutingLogOutput io.Writer
+}
+
+// redactedRegistryConfig is RegistryConfig without MarshalLog
+type redactedRegistryConfig RegistryConfig
+
+// MarshalLog implements logr.Marshaler, redacting secrets when logged
+func (rc RegistryConfig) MarshalLog() any {
+	redacted := redactedRegistryConfig(rc)
+	if redacted.AdminToken != "" {
+		redacted.AdminToken = "REDACTED"
+	}
+	return redacted
+}
+
+// ValidateMaxForwardedForEntries returns an error if maxEntries cannot
+// include both the client and load balancer X-Forwarded-For entries
+//
+// 0 means no limit, otherwise at least 2 entries are needed or every request
+// with X-Forwarded-For would be rejected.
+func ValidateMaxForwardedForEntries(maxEntries int) error {
+	if maxEntries < 0 || maxEntries == 1 {
+		return fmt.Errorf("invalid max X-Forwarded-For entries %d, expected 0 for no limit or at least 2", maxEntries)
+	}
+	return nil
+}
+
+const (
+	// slowRequestsMaxAge is how long requests are kept for /admin/slowest
+	slowRequestsMaxAge = time.Hour
+	// repeatedBlobRequestWindow is the window for RepeatedBlobRequestThreshold
+	repeatedBlobRequestWindow = time.Minute
+	// repeatedBlobRequestMaxClients bounds tracking repeated blob requests
+	repeatedBlobRequestMaxClients = 10000
+	// backgroundQueueSize bounds pending background tasks
+	backgroundQueueSize = 100
+	// defaultBackgroundWorkers is the default cap for NewBackgroundPool
+	defaultBackgroundWorkers = 10
+	// fallbackProbeBurst is how many fallback probes FallbackProbeRatio
+	// allows before it has any lookups to base the fraction on
+	fallbackProbeBurst = 10
+	// errorLogSummaryInterval is how often suppressed error logs are counted
+	errorLogSummaryInterval = time.Minute
+)
+
+// apiAllowedMethods is the Allow header value for registry API paths
+const apiAllowedMethods = "GET, HEAD, OPTIONS"
+
+// defaultDigestAlgorithms are the blob digest algorithms served by default,
+// and the only ones AllowedDigestAlgorithms may list
+var defaultDigestAlgorithms = []string{"sha256", "sha512"}
+
+// ValidateDigestAlgorithms returns an error if any of algorithms is not one
+// of defaultDigestAlgorithms, which are all the OCI spec registers
+func ValidateDigestAlgorithms(algorithms []string) error {
+	for _, algorithm := range algorithms {
+		if !slices.Contains(defaultDigestAlgorithms, algorithm) {
+			return fmt.Errorf("unknown digest algorithm %q, expected one of %v", algorithm, defaultDigestAlgorithms)
+		}
+	}
+	return nil
 }
 
 // MakeHandler returns the root archeio HTTP handler
@@ -41,11 +213,34 @@ type RegistryConfig struct {
 // upstream registry should be the url to the primary registry
 // archeio is fronting.
 //
+// The handler implements io.Closer, to stop its background tasks once it is
+// no longer serving, see ReloadableHandler.
+//
 // Exact behavior should be documented in docs/request-handling.md
 func MakeHandler(rc RegistryConfig) http.Handler {
-	blobs := newCachedBlobChecker()
-	doV2 := makeV2Handler(rc, blobs)
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	ctx, stop := context.WithCancel(context.Background())
+	blobs := newCachedBlobChecker(rc)
+	slowest := newSlowRequests(rc.SlowRequestsLimit, slowRequestsMaxAge)
+	var routes *routingLogger
+	if rc.RoutingLogFormat == RoutingLogFormatV1 {
+		routes = newRoutingLogger(routingLogOutput(rc))
+	}
+	doV2 := makeV2Handler(ctx, rc, blobs, newHTTPBlobProxy(rc.ProxyBlobGzip), slowest, routes, newLookupGroup(nil))
+	admin := makeAdminHandler(rc, slowest, &blobs.blobCache)
+	maintenance := newMaintenanceWindow(rc.MaintenanceWarning, rc.MaintenanceStart, rc.MaintenanceEnd)
+	handler := maintenance.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// operator endpoints, these are authenticated separately
+		if strings.HasPrefix(r.URL.Path, "/admin/") {
+			admin.ServeHTTP(w, r)
+			return
+		}
+		// some clients send OPTIONS before API calls even outside of CORS,
+		// answer these directly rather than treating them as pulls
+		if r.Method == http.MethodOptions && strings.HasPrefix(r.URL.Path, "/v2") {
+			w.Header().Set("Allow", apiAllowedMethods)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
 		// only allow GET, HEAD
 		// this is all a client needs to pull images
 		// we do *not* support mutation
@@ -67,10 +262,28 @@ func MakeHandler(rc RegistryConfig) http.Handler {
 			klog.V(2).InfoS("unknown request", "path", path)
 			http.NotFound(w, r)
 		}
-	})
+	}))
+	return &closingHandler{Handler: handler, stop: stop}
+}
+
+// closingHandler is an http.Handler with background tasks, stopped by Close
+type closingHandler struct {
+	http.Handler
+	stop context.CancelFunc
 }
 
-func makeV2Handler(rc RegistryConfig, blobs blobChecker) func(w http.ResponseWriter, r *http.Request) {
+// Close stops the handler's background tasks
+func (h *closingHandler) Close() error {
+	h.stop()
+	return nil
+}
+
+// makeV2Handler returns the /v2/ registry API handler, its background tasks
+// run until ctx is done
+//
+// inflight coalesces identical concurrent blob lookups from the same client,
+// e.g. when it is retrying aggressively, nil disables coalescing.
+func makeV2Handler(ctx context.Context, rc RegistryConfig, blobs blobChecker, proxy blobProxy, slowest *slowRequests, routes *routingLogger, inflight *lookupGroup) func(w http.ResponseWriter, r *http.Request) {
 	// matches blob requests, captures the requested blob hash
 	// https://github.com/opencontainers/distribution-spec/blob/main/spec.md#pull
 	// Blobs are at `/v2/<name>/blobs/<digest>`
@@ -80,10 +293,78 @@ func makeV2Handler(rc RegistryConfig, blobs blobChecker) func(w http.ResponseWri
 	reBlob := regexp.MustCompile("^/v2/.*/blobs/([^/]+:[a-zA-Z0-9=_-]+)$")
 	// initialize map of clientIP to AWS region
 	regionMapper := cloudcidrs.NewIPMapper()
+	// regions we should serve blob content for directly
+	proxyRegions := make(map[string]bool, len(rc.ProxyBlobRegions))
+	for _, region := range rc.ProxyBlobRegions {
+		proxyRegions[region] = true
+	}
+	// digest algorithms we serve blobs for
+	allowedAlgorithms := rc.AllowedDigestAlgorithms
+	if len(allowedAlgorithms) == 0 {
+		allowedAlgorithms = defaultDigestAlgorithms
+	}
+	digestAlgorithms := make(map[string]bool, len(allowedAlgorithms))
+	for _, algorithm := range allowedAlgorithms {
+		digestAlgorithms[algorithm] = true
+	}
+	// limits probing fallback buckets when primaries are failing
+	var fallbackBudget *retryBudget
+	if rc.FallbackProbeRatio > 0 {
+		fallbackBudget = newRetryBudget(rc.FallbackProbeRatio, fallbackProbeBurst)
+	}
+	// detects clients not following redirects
+	repeats := newRepeatDetector(rc.RepeatedBlobRequestThreshold, repeatedBlobRequestWindow, repeatedBlobRequestMaxClients)
+	// runs short background tasks, long running loops get their own
+	// goroutine instead so they cannot starve these of workers
+	pool := rc.BackgroundPool
+	if pool == nil {
+		pool = NewBackgroundPool(0)
+	}
+	// warms the cache for nearby regions in the background
+	var warmer *neighborWarmer
+	if len(rc.NeighborRegions) > 0 {
+		warmer = newNeighborWarmer(blobs, rate.Limit(rc.NeighborWarmQPS), pool)
+	}
+	// error logs caused by bad requests, optionally rate limited
+	var errorLogs *errorLogLimiter
+	if rc.ErrorLogQPS > 0 {
+		errorLogs = newErrorLogLimiter(rate.Limit(rc.ErrorLogQPS), max(1, int(rc.ErrorLogQPS)))
+		go errorLogs.Run(ctx, errorLogSummaryInterval)
+	}
+	// candidate mirrors for Link headers and cost-aware routing, and the
+	// region of each, for reporting on the bucket a blob was served from
+	buckets := knownBuckets()
+	bucketRegions := make(map[string]string, len(buckets))
+	for _, b := range buckets {
+		bucketRegions[b.url] = b.region
+	}
 	// capture these in a http handler lambda
 	return func(w http.ResponseWriter, r *http.Request) {
 		rPath := r.URL.Path
 
+		// track where we send requests, for debugging slow requests
+		start := time.Now()
+		clientCloud, clientRegion, backend := "", "", ""
+		decision := decisionRejected
+		// readiness checks are synthetic, so should not skew what we track
+		instrumented := !isReadinessCheck(r)
+		defer func() {
+			if !instrumented {
+				return
+			}
+			duration := time.Since(start)
+			slowest.Record(rPath, clientRegion, backend, duration)
+			routes.Log(routingRecord{
+				Method:       r.Method,
+				Path:         rPath,
+				ClientCloud:  clientCloud,
+				ClientRegion: clientRegion,
+				Decision:     decision,
+				Backend:      backend,
+				DurationMS:   float64(duration) / float64(time.Millisecond),
+			})
+		}()
+
 		// we only care about publicly readable GCR as the backing registry
 		// or publicly readable blob storage
 		//
@@ -98,6 +379,7 @@ func makeV2Handler(rc RegistryConfig, blobs blobChecker) func(w http.ResponseWri
 		// returning 401, prompting token auth
 		if rPath == "/v2/" || rPath == "/v2" {
 			klog.V(2).InfoS("serving 200 OK for /v2/ check", "path", rPath)
+			decision = decisionAPICheck
 			// NOTE: OCI does not require this, but the docker v2 spec include it, and GCR sets this
 			// Docker distribution v2 clients may fallback to an older version if this is not set.
 			w.Header().Set("Docker-Distribution-Api-Version", "registry/2.0")
@@ -107,59 +389,212 @@ func makeV2Handler(rc RegistryConfig, blobs blobChecker) func(w http.ResponseWri
 		// we don't support the non-standard _catalog API
 		// https://github.com/kubernetes/registry.k8s.io/issues/162
 		if rPath == "/v2/_catalog" {
+			decision = decisionNotFound
 			http.Error(w, "_catalog is not supported", http.StatusNotFound)
 			return
 		}
+		// paths nesting API verbs are ambiguous, don't guess what they mean
+		repository, _, err := parseAPIPath(rPath)
+		if err != nil {
+			klog.V(2).InfoS("rejecting request with ambiguous path", "path", rPath)
+			writeOCIError(w, http.StatusBadRequest, errCodeNameInvalid, err.Error())
+			return
+		}
+		// some repositories' clients need a different redirect status
+		status := redirectStatus(rc.RedirectStatusOverrides, repository)
 
 		// check if blob request
 		matches := reBlob.FindStringSubmatch(rPath)
 		if len(matches) != 2 {
 			// not a blob request so forward it to the main upstream registry
 			redirectURL := upstreamRedirectURL(rc, rPath)
+			backend, decision = rc.UpstreamRegistryEndpoint, decisionRedirectUpstream
 			klog.V(2).InfoS("redirecting manifest request to upstream registry", "path", rPath, "redirect", redirectURL)
-			http.Redirect(w, r, redirectURL, http.StatusTemporaryRedirect)
+			http.Redirect(w, r, redirectURL, status)
 			return
 		}
 		// it is a blob request, grab the hash for later
 		digest := matches[1]
+		// some clients also send the digest as a query parameter,
+		// if they disagree the client is confused and we should not guess
+		if queryDigest := r.URL.Query().Get("digest"); queryDigest != "" && queryDigest != digest {
+			klog.V(2).InfoS("rejecting blob request with mismatched digests", "path", rPath, "digest", queryDigest)
+			writeOCIError(w, http.StatusBadRequest, errCodeDigestInvalid, "digest query parameter does not match digest in path")
+			return
+		}
+		if algorithm, _, _ := strings.Cut(digest, ":"); !digestAlgorithms[algorithm] {
+			klog.V(2).InfoS("rejecting blob request with disallowed digest algorithm", "path", rPath, "algorithm", algorithm)
+			writeOCIError(w, http.StatusBadRequest, errCodeDigestInvalid, "unsupported digest algorithm: "+algorithm)
+			return
+		}
 
 		// for blob requests, check the client IP and determine the best backend
-		clientIP, err := clientip.Get(r)
+		clientIP, truncated, err := clientip.GetLimited(r, rc.MaxForwardedForEntries)
+		if truncated {
+			klog.V(2).InfoS("truncated X-Forwarded-For", "path", rPath)
+			forwardedForTruncatedTotal.Inc()
+		}
 		if err != nil {
 			// this should not happen
-			klog.ErrorS(err, "failed to get client IP")
+			errorLogs.ErrorS(err, "failed to get client IP")
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		// we can't make clients follow redirects, but we can help support
+		// figure out why they keep coming back
+		if instrumented && repeats.Observe(clientIP, digest) {
+			klog.InfoS("client repeatedly requesting blob, possibly ignoring redirects", "path", rPath, "userAgent", r.UserAgent())
+			redirectIgnoredTotal.Inc()
+		}
 
 		// if client is coming from GCP, stay in GCP
 		ipInfo, ipIsKnown := regionMapper.GetIP(clientIP)
+		clientCloud, clientRegion = ipInfo.Cloud, ipInfo.Region
 		if ipIsKnown && ipInfo.Cloud == cloudcidrs.GCP {
 			redirectURL := upstreamRedirectURL(rc, rPath)
+			backend, decision = rc.UpstreamRegistryEndpoint, decisionRedirectUpstream
 			klog.V(2).InfoS("redirecting GCP blob request to upstream registry", "path", rPath, "redirect", redirectURL)
-			http.Redirect(w, r, redirectURL, http.StatusTemporaryRedirect)
+			http.Redirect(w, r, redirectURL, status)
 			return
 		}
 
 		// check if blob is available in our AWS layer storage for the region
-		region := ""
+		region := rc.SelfRegion
 		if ipIsKnown {
 			region = ipInfo.Region
 		}
 		bucketURL := awsRegionToHostURL(region, rc.DefaultAWSBaseURL)
-		// this matches GCR's GCS layout, which we will use for other buckets
-		blobURL := bucketURL + "/containers/images/" + digest
-		if blobs.BlobExists(blobURL) {
+		candidates := []string{bucketURL}
+		if rc.CostAwareRouting {
+			candidates = costAwareBucketURLs(buckets, region, bucketURL, digest, rc.EgressCostPerGB, rc.CostWeight, rc.CostTieBreaker)
+		}
+		protocol := negotiatedProtocol(r)
+		if preferred, ok := rc.ProtocolBackends[protocol]; ok {
+			candidates = append([]string{preferred}, candidates...)
+		}
+		// use the first candidate bucket with the blob
+		lookup := inflight.Do(clientIP.String()+" "+digest+" "+protocol, func() blobLookup {
+			var result blobLookup
+			fallbackBudget.Deposit()
+			for i, candidate := range candidates {
+				// past the first candidate we are falling back, which is
+				// limited so failing primaries don't overwhelm fallbacks
+				if i > 0 && !fallbackBudget.Withdraw() {
+					fallbackProbesSkippedTotal.Inc()
+					result.unprobed = candidates[i:]
+					return result
+				}
+				exists, err := blobs.BlobExists(r.Context(), bucketBlobURL(rc, candidate, digest))
+				if err != nil {
+					klog.V(2).InfoS("failed to check for blob", "path", rPath, "bucket", candidate, "err", err)
+					result.failed = true
+					continue
+				}
+				if exists {
+					result.bucketURL = candidate
+					return result
+				}
+			}
+			return result
+		})
+		blobExists := lookup.bucketURL != ""
+		if blobExists {
+			bucketURL = lookup.bucketURL
+		} else if slices.Contains(lookup.unprobed, bucketURL) {
+			// we could not afford to check, so route as if we had not
+			// tried any other candidates, to the usual bucket unverified
+			klog.V(2).InfoS("fallback probe budget exhausted, using usual bucket unverified", "path", rPath)
+			blobExists = true
+		}
+		blobURL := bucketBlobURL(rc, bucketURL, digest)
+		if blobExists && egressCostTrusted(rc, clientIP) {
+			setEgressCostHeaders(w, rc, blobs, bucketRegions[bucketURL], blobURL)
+		}
+		// some regions cannot be redirected to the bucket directly,
+		// for those we stream the blob through archeio instead
+		if blobExists && proxyRegions[region] {
+			err := proxy.ProxyBlob(w, r, blobURL)
+			if err == nil {
+				backend, decision = bucketURL, decisionProxyAWS
+				recordRegionServed(bucketRegions[bucketURL])
+				klog.V(2).InfoS("proxied blob request from AWS", "path", rPath)
+				warmNeighbors(rc, warmer, region, bucketURL, digest)
+				return
+			}
+			// nothing has been written yet, fall back to upstream below
+			errorLogs.ErrorS(err, "failed to proxy blob", "url", blobURL)
+			clearEgressCostHeaders(w)
+		} else if blobExists {
 			// blob known to be available in AWS, redirect client there
+			// smart clients may use the alternates to fail over themselves
+			for _, alternate := range alternateBucketURLs(buckets, region, bucketURL, rc.BlobAlternateLinks) {
+				w.Header().Add("Link", "<"+bucketBlobURL(rc, alternate, digest)+`>; rel="alternate"`)
+			}
+			backend, decision = bucketURL, decisionRedirectAWS
+			redirectURL := blobURL
+			if rc.Backends[bucketURL].ForwardQuery {
+				redirectURL = withQuery(blobURL, r.URL.RawQuery)
+			}
 			klog.V(2).InfoS("redirecting blob request to AWS", "path", rPath)
-			http.Redirect(w, r, blobURL, http.StatusTemporaryRedirect)
+			http.Redirect(w, r, redirectURL, status)
+			recordRegionServed(bucketRegions[bucketURL])
+			warmNeighbors(rc, warmer, region, bucketURL, digest)
+			return
+		}
+
+		// some deployments would rather clients fail than fetch from upstream,
+		// but only blobs that were checked for are known to be missing
+		if !blobExists && rc.DisableUpstreamBlobFallback && len(lookup.unprobed) == 0 {
+			// a missing blob may be cached by clients, so only report one if
+			// every bucket said so, rather than failing to tell us
+			if lookup.failed {
+				klog.V(2).InfoS("failed to check for blob in AWS, not falling back to upstream registry", "path", rPath)
+				decision = decisionUnavailable
+				writeOCIError(w, http.StatusServiceUnavailable, errCodeUnavailable, "blob storage unavailable, try again later")
+				return
+			}
+			klog.V(2).InfoS("blob not found in AWS, not falling back to upstream registry", "path", rPath)
+			decision = decisionNotFound
+			writeOCIError(w, http.StatusNotFound, errCodeBlobUnknown, "blob unknown to registry")
 			return
 		}
 
 		// fall back to redirect to upstream
 		redirectURL := upstreamRedirectURL(rc, rPath)
+		backend, decision = rc.UpstreamRegistryEndpoint, decisionRedirectUpstream
 		klog.V(2).InfoS("redirecting blob request to upstream registry", "path", rPath, "redirect", redirectURL)
-		http.Redirect(w, r, redirectURL, http.StatusTemporaryRedirect)
+		http.Redirect(w, r, redirectURL, status)
+	}
+}
+
+// negotiatedProtocol returns the TLS ALPN protocol negotiated for r,
+// or "" if archeio did not terminate TLS or none was negotiated
+func negotiatedProtocol(r *http.Request) string {
+	if r.TLS == nil {
+		return ""
+	}
+	return r.TLS.NegotiatedProtocol
+}
+
+// recordRegionServed records that a blob request was served from the AWS
+// bucket in region, so we can tell if a bucket has stopped receiving traffic
+//
+// This is the serving bucket's region, which may differ from the client's,
+// e.g. with CostAwareRouting, and is "" for buckets outside knownBuckets.
+func recordRegionServed(region string) {
+	if region == "" {
+		region = "unknown"
+	}
+	regionLastServeTimestampSeconds.WithLabelValues(region).SetToCurrentTime()
+}
+
+// warmNeighbors queues probes for digest in the buckets for neighbors of region
+func warmNeighbors(rc RegistryConfig, warmer *neighborWarmer, region, bucketURL, digest string) {
+	for _, neighbor := range rc.NeighborRegions[region] {
+		neighborBucketURL := awsRegionToHostURL(neighbor, rc.DefaultAWSBaseURL)
+		if neighborBucketURL != bucketURL {
+			warmer.Enqueue(bucketBlobURL(rc, neighborBucketURL, digest))
+		}
 	}
 }
 
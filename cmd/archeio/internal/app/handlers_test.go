@@ -17,10 +17,20 @@ limitations under the License.
 package app
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestMakeHandler(t *testing.T) {
@@ -145,10 +155,60 @@ func TestMakeHandler(t *testing.T) {
 
 type fakeBlobsChecker struct {
 	knownURLs map[string]bool
+	// failingURLs cannot be checked either way
+	failingURLs map[string]bool
+}
+
+func (f *fakeBlobsChecker) BlobExists(_ context.Context, blobURL string) (bool, error) {
+	if f.failingURLs[blobURL] {
+		return false, errors.New("backend unavailable")
+	}
+	return f.knownURLs[blobURL], nil
 }
 
-func (f *fakeBlobsChecker) BlobExists(blobURL string) bool {
-	return f.knownURLs[blobURL]
+func TestMakeHandlerOptions(t *testing.T) {
+	handler := MakeHandler(RegistryConfig{
+		UpstreamRegistryEndpoint: "https://k8s.gcr.io",
+	})
+	testCases := []struct {
+		Name           string
+		URL            string
+		ExpectedStatus int
+		ExpectedAllow  string
+	}{
+		{
+			Name:           "blob",
+			URL:            "http://localhost:8080/v2/pause/blobs/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e",
+			ExpectedStatus: http.StatusNoContent,
+			ExpectedAllow:  "GET, HEAD, OPTIONS",
+		},
+		{
+			Name:           "/v2/",
+			URL:            "http://localhost:8080/v2/",
+			ExpectedStatus: http.StatusNoContent,
+			ExpectedAllow:  "GET, HEAD, OPTIONS",
+		},
+		{
+			Name:           "non-API path",
+			URL:            "http://localhost:8080/privacy",
+			ExpectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodOptions, tc.URL, nil))
+			response := recorder.Result()
+			if response.StatusCode != tc.ExpectedStatus {
+				t.Fatalf("expected status: %d, but got status: %d", tc.ExpectedStatus, response.StatusCode)
+			}
+			if allow := response.Header.Get("Allow"); allow != tc.ExpectedAllow {
+				t.Fatalf("expected Allow: %q, but got: %q", tc.ExpectedAllow, allow)
+			}
+		})
+	}
 }
 
 func TestMakeV2Handler(t *testing.T) {
@@ -170,7 +230,7 @@ func TestMakeV2Handler(t *testing.T) {
 			"https://prod-registry-k8s-io-us-west-1.s3.dualstack.us-west-1.amazonaws.com/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e":           true,
 		},
 	}
-	handler := makeV2Handler(registryConfig, &blobs)
+	handler := makeV2Handler(context.Background(), registryConfig, &blobs, newHTTPBlobProxy(false), nil, nil, nil)
 	testCases := []struct {
 		Name           string
 		Request        *http.Request
@@ -271,3 +331,1020 @@ func TestMakeV2Handler(t *testing.T) {
 		})
 	}
 }
+
+type fakeBlobProxy struct {
+	err error
+}
+
+func (f *fakeBlobProxy) ProxyBlob(w http.ResponseWriter, _ *http.Request, blobURL string) error {
+	if f.err != nil {
+		return f.err
+	}
+	w.Header().Set("X-Proxied-URL", blobURL)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func TestMakeV2HandlerProxyBlobRegions(t *testing.T) {
+	registryConfig := RegistryConfig{
+		UpstreamRegistryEndpoint: "https://k8s.gcr.io",
+		ProxyBlobRegions:         []string{"eu-west-3"},
+	}
+	const blobPath = "/v2/pause/blobs/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	const euWest3BlobURL = "https://prod-registry-k8s-io-eu-west-3.s3.dualstack.eu-west-3.amazonaws.com/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	const euWest1BlobURL = "https://prod-registry-k8s-io-eu-west-1.s3.dualstack.eu-west-1.amazonaws.com/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	blobs := &fakeBlobsChecker{
+		knownURLs: map[string]bool{
+			euWest3BlobURL: true,
+			euWest1BlobURL: true,
+		},
+	}
+	testCases := []struct {
+		Name               string
+		RemoteAddr         string
+		Proxy              blobProxy
+		ExpectedStatus     int
+		ExpectedURL        string
+		ExpectedProxiedURL string
+	}{
+		{
+			Name:               "proxied region",
+			RemoteAddr:         "35.180.1.1:888",
+			Proxy:              &fakeBlobProxy{},
+			ExpectedStatus:     http.StatusOK,
+			ExpectedProxiedURL: euWest3BlobURL,
+		},
+		{
+			Name:           "proxied region, proxy fails",
+			RemoteAddr:     "35.180.1.1:888",
+			Proxy:          &fakeBlobProxy{err: errors.New("backend unavailable")},
+			ExpectedStatus: http.StatusTemporaryRedirect,
+			ExpectedURL:    "https://k8s.gcr.io/v2/pause/blobs/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e",
+		},
+		{
+			Name:           "non-proxied region",
+			RemoteAddr:     "52.208.1.1:888",
+			Proxy:          &fakeBlobProxy{},
+			ExpectedStatus: http.StatusTemporaryRedirect,
+			ExpectedURL:    euWest1BlobURL,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			handler := makeV2Handler(context.Background(), registryConfig, blobs, tc.Proxy, nil, nil, nil)
+			r := httptest.NewRequest("GET", "http://localhost:8080"+blobPath, nil)
+			r.RemoteAddr = tc.RemoteAddr
+			recorder := httptest.NewRecorder()
+			handler(recorder, r)
+			response := recorder.Result()
+			if response.StatusCode != tc.ExpectedStatus {
+				t.Fatalf("expected status: %d, but got status: %d", tc.ExpectedStatus, response.StatusCode)
+			}
+			if location := response.Header.Get("Location"); location != tc.ExpectedURL {
+				t.Fatalf("expected url: %q, but got: %q", tc.ExpectedURL, location)
+			}
+			if proxied := response.Header.Get("X-Proxied-URL"); proxied != tc.ExpectedProxiedURL {
+				t.Fatalf("expected proxied url: %q, but got: %q", tc.ExpectedProxiedURL, proxied)
+			}
+		})
+	}
+}
+
+func TestMakeV2HandlerSelfRegion(t *testing.T) {
+	const blobPath = "/v2/pause/blobs/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	const euWest1BlobURL = "https://prod-registry-k8s-io-eu-west-1.s3.dualstack.eu-west-1.amazonaws.com/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	const usEast2BlobURL = "https://prod-registry-k8s-io-us-east-2.s3.dualstack.us-east-2.amazonaws.com/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	const defaultBlobURL = "https://default.example.com/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	blobs := &fakeBlobsChecker{
+		knownURLs: map[string]bool{
+			euWest1BlobURL: true,
+			usEast2BlobURL: true,
+			defaultBlobURL: true,
+		},
+	}
+	testCases := []struct {
+		Name        string
+		SelfRegion  string
+		RemoteAddr  string
+		ExpectedURL string
+	}{
+		{
+			Name:        "unknown client uses self region",
+			SelfRegion:  "us-east-2",
+			RemoteAddr:  "192.0.2.1:888",
+			ExpectedURL: usEast2BlobURL,
+		},
+		{
+			Name:        "known client uses its own region",
+			SelfRegion:  "us-east-2",
+			RemoteAddr:  "52.208.1.1:888",
+			ExpectedURL: euWest1BlobURL,
+		},
+		{
+			Name:        "unknown client without self region",
+			RemoteAddr:  "192.0.2.1:888",
+			ExpectedURL: defaultBlobURL,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			registryConfig := RegistryConfig{
+				UpstreamRegistryEndpoint: "https://k8s.gcr.io",
+				DefaultAWSBaseURL:        "https://default.example.com",
+				SelfRegion:               tc.SelfRegion,
+			}
+			handler := makeV2Handler(context.Background(), registryConfig, blobs, &fakeBlobProxy{}, nil, nil, nil)
+			r := httptest.NewRequest("GET", "http://localhost:8080"+blobPath, nil)
+			r.RemoteAddr = tc.RemoteAddr
+			recorder := httptest.NewRecorder()
+			handler(recorder, r)
+			if location := recorder.Result().Header.Get("Location"); location != tc.ExpectedURL {
+				t.Fatalf("expected url: %q, but got: %q", tc.ExpectedURL, location)
+			}
+		})
+	}
+}
+
+func TestValidateDigestAlgorithms(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		Name        string
+		Algorithms  []string
+		ExpectError bool
+	}{
+		{
+			Name: "default",
+		},
+		{
+			Name:       "known",
+			Algorithms: []string{"sha256", "sha512"},
+		},
+		{
+			Name:        "unknown",
+			Algorithms:  []string{"sha256", "md5"},
+			ExpectError: true,
+		},
+		{
+			Name:        "untrimmed",
+			Algorithms:  []string{"sha256", " sha512"},
+			ExpectError: true,
+		},
+		{
+			Name:        "empty entry",
+			Algorithms:  []string{"sha256", ""},
+			ExpectError: true,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			err := ValidateDigestAlgorithms(tc.Algorithms)
+			if tc.ExpectError && err == nil {
+				t.Fatal("expected error but got none")
+			} else if !tc.ExpectError && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateMaxForwardedForEntries(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		Name        string
+		MaxEntries  int
+		ExpectError bool
+	}{
+		{
+			Name: "no limit",
+		},
+		{
+			Name:       "client and load balancer",
+			MaxEntries: 2,
+		},
+		{
+			Name:       "default",
+			MaxEntries: 20,
+		},
+		{
+			Name:        "load balancer only",
+			MaxEntries:  1,
+			ExpectError: true,
+		},
+		{
+			Name:        "negative",
+			MaxEntries:  -1,
+			ExpectError: true,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			err := ValidateMaxForwardedForEntries(tc.MaxEntries)
+			if tc.ExpectError && err == nil {
+				t.Fatal("expected error but got none")
+			} else if !tc.ExpectError && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestMakeV2HandlerMaxForwardedForEntries(t *testing.T) {
+	registryConfig := RegistryConfig{
+		UpstreamRegistryEndpoint: "https://k8s.gcr.io",
+		MaxForwardedForEntries:   2,
+	}
+	const euWest1BlobURL = "https://prod-registry-k8s-io-eu-west-1.s3.dualstack.eu-west-1.amazonaws.com/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	blobs := &fakeBlobsChecker{
+		knownURLs: map[string]bool{euWest1BlobURL: true},
+	}
+	handler := makeV2Handler(context.Background(), registryConfig, blobs, &fakeBlobProxy{}, nil, nil, nil)
+	before := testutil.ToFloat64(forwardedForTruncatedTotal)
+	r := httptest.NewRequest("GET", "http://localhost:8080/v2/pause/blobs/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e", nil)
+	r.Header.Set("X-Forwarded-For", strings.Repeat("1.2.3.4, ", 10000)+"52.208.1.1, 8.8.8.9")
+	recorder := httptest.NewRecorder()
+	handler(recorder, r)
+	if location := recorder.Result().Header.Get("Location"); location != euWest1BlobURL {
+		t.Fatalf("expected url: %q, but got: %q", euWest1BlobURL, location)
+	}
+	if truncated := testutil.ToFloat64(forwardedForTruncatedTotal) - before; truncated != 1 {
+		t.Fatalf("expected one truncated request, got: %v", truncated)
+	}
+}
+
+func TestMakeV2HandlerCostAwareRouting(t *testing.T) {
+	const blobPath = "/v2/pause/blobs/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	const euWest1BlobURL = "https://prod-registry-k8s-io-eu-west-1.s3.dualstack.eu-west-1.amazonaws.com/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	const euWest3BlobURL = "https://prod-registry-k8s-io-eu-west-3.s3.dualstack.eu-west-3.amazonaws.com/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	costPerGB := map[string]float64{
+		"eu-west-1": 0.09,
+		"eu-west-3": 0.02,
+	}
+	testCases := []struct {
+		Name        string
+		CostWeight  float64
+		KnownURLs   map[string]bool
+		ExpectedURL string
+	}{
+		{
+			Name:        "cost weighted picks cheaper nearby bucket",
+			CostWeight:  0.9,
+			KnownURLs:   map[string]bool{euWest1BlobURL: true, euWest3BlobURL: true},
+			ExpectedURL: euWest3BlobURL,
+		},
+		{
+			Name:        "proximity weighted picks usual bucket",
+			CostWeight:  0.1,
+			KnownURLs:   map[string]bool{euWest1BlobURL: true, euWest3BlobURL: true},
+			ExpectedURL: euWest1BlobURL,
+		},
+		{
+			Name:        "cheaper bucket missing blob",
+			CostWeight:  0.9,
+			KnownURLs:   map[string]bool{euWest1BlobURL: true},
+			ExpectedURL: euWest1BlobURL,
+		},
+		{
+			Name:        "no bucket has blob",
+			CostWeight:  0.9,
+			ExpectedURL: "https://k8s.gcr.io" + blobPath,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			registryConfig := RegistryConfig{
+				UpstreamRegistryEndpoint: "https://k8s.gcr.io",
+				CostAwareRouting:         true,
+				CostWeight:               tc.CostWeight,
+				EgressCostPerGB:          costPerGB,
+			}
+			handler := makeV2Handler(context.Background(), registryConfig, &fakeBlobsChecker{knownURLs: tc.KnownURLs}, &fakeBlobProxy{}, nil, nil, nil)
+			r := httptest.NewRequest("GET", "http://localhost:8080"+blobPath, nil)
+			r.RemoteAddr = "52.208.1.1:888"
+			recorder := httptest.NewRecorder()
+			handler(recorder, r)
+			if location := recorder.Result().Header.Get("Location"); location != tc.ExpectedURL {
+				t.Fatalf("expected url: %q, but got: %q", tc.ExpectedURL, location)
+			}
+		})
+	}
+}
+
+func TestMakeV2HandlerUpstreamBlobFallback(t *testing.T) {
+	const blobPath = "/v2/pause/blobs/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	const euWest1BlobURL = "https://prod-registry-k8s-io-eu-west-1.s3.dualstack.eu-west-1.amazonaws.com/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	const euWest3BlobURL = "https://prod-registry-k8s-io-eu-west-3.s3.dualstack.eu-west-3.amazonaws.com/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	testCases := []struct {
+		Name              string
+		Disabled          bool
+		CostAwareRouting  bool
+		Blobs             fakeBlobsChecker
+		RemoteAddr        string
+		ExpectedStatus    int
+		ExpectedURL       string
+		ExpectedErrorCode string
+	}{
+		{
+			Name:           "all buckets miss, fallback enabled",
+			RemoteAddr:     "52.208.1.1:888",
+			ExpectedStatus: http.StatusTemporaryRedirect,
+			ExpectedURL:    "https://k8s.gcr.io" + blobPath,
+		},
+		{
+			Name:              "all buckets miss, fallback disabled",
+			Disabled:          true,
+			RemoteAddr:        "52.208.1.1:888",
+			ExpectedStatus:    http.StatusNotFound,
+			ExpectedErrorCode: errCodeBlobUnknown,
+		},
+		{
+			Name:           "bucket check fails, fallback enabled",
+			Blobs:          fakeBlobsChecker{failingURLs: map[string]bool{euWest1BlobURL: true}},
+			RemoteAddr:     "52.208.1.1:888",
+			ExpectedStatus: http.StatusTemporaryRedirect,
+			ExpectedURL:    "https://k8s.gcr.io" + blobPath,
+		},
+		{
+			Name:              "bucket check fails, fallback disabled",
+			Disabled:          true,
+			Blobs:             fakeBlobsChecker{failingURLs: map[string]bool{euWest1BlobURL: true}},
+			RemoteAddr:        "52.208.1.1:888",
+			ExpectedStatus:    http.StatusServiceUnavailable,
+			ExpectedErrorCode: errCodeUnavailable,
+		},
+		{
+			Name:              "one of several bucket checks fails, others miss, fallback disabled",
+			Disabled:          true,
+			CostAwareRouting:  true,
+			Blobs:             fakeBlobsChecker{failingURLs: map[string]bool{euWest1BlobURL: true}},
+			RemoteAddr:        "52.208.1.1:888",
+			ExpectedStatus:    http.StatusServiceUnavailable,
+			ExpectedErrorCode: errCodeUnavailable,
+		},
+		{
+			Name:             "bucket check fails, found in another, fallback disabled",
+			Disabled:         true,
+			CostAwareRouting: true,
+			Blobs: fakeBlobsChecker{
+				failingURLs: map[string]bool{euWest1BlobURL: true},
+				knownURLs:   map[string]bool{euWest3BlobURL: true},
+			},
+			RemoteAddr:     "52.208.1.1:888",
+			ExpectedStatus: http.StatusTemporaryRedirect,
+			ExpectedURL:    euWest3BlobURL,
+		},
+		{
+			Name:           "GCP client, fallback disabled",
+			Disabled:       true,
+			RemoteAddr:     "35.220.26.1:888",
+			ExpectedStatus: http.StatusTemporaryRedirect,
+			ExpectedURL:    "https://k8s.gcr.io" + blobPath,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			registryConfig := RegistryConfig{
+				UpstreamRegistryEndpoint:    "https://k8s.gcr.io",
+				DisableUpstreamBlobFallback: tc.Disabled,
+				CostAwareRouting:            tc.CostAwareRouting,
+			}
+			handler := makeV2Handler(context.Background(), registryConfig, &tc.Blobs, &fakeBlobProxy{}, nil, nil, nil)
+			r := httptest.NewRequest("GET", "http://localhost:8080"+blobPath, nil)
+			r.RemoteAddr = tc.RemoteAddr
+			recorder := httptest.NewRecorder()
+			handler(recorder, r)
+			response := recorder.Result()
+			if response.StatusCode != tc.ExpectedStatus {
+				t.Fatalf("expected status: %d, but got status: %d", tc.ExpectedStatus, response.StatusCode)
+			}
+			if location := response.Header.Get("Location"); location != tc.ExpectedURL {
+				t.Fatalf("expected url: %q, but got: %q", tc.ExpectedURL, location)
+			}
+			if tc.ExpectedErrorCode != "" {
+				assertOCIErrorCode(t, response, tc.ExpectedErrorCode)
+			}
+		})
+	}
+}
+
+func TestMakeV2HandlerDigestQuery(t *testing.T) {
+	registryConfig := RegistryConfig{
+		UpstreamRegistryEndpoint: "https://k8s.gcr.io",
+	}
+	handler := makeV2Handler(context.Background(), registryConfig, &fakeBlobsChecker{}, &fakeBlobProxy{}, nil, nil, nil)
+	const blobPath = "/v2/pause/blobs/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	testCases := []struct {
+		Name              string
+		URL               string
+		ExpectedStatus    int
+		ExpectedURL       string
+		ExpectedErrorCode string
+	}{
+		{
+			Name:           "path digest only",
+			URL:            "http://localhost:8080" + blobPath,
+			ExpectedStatus: http.StatusTemporaryRedirect,
+			ExpectedURL:    "https://k8s.gcr.io" + blobPath,
+		},
+		{
+			Name:           "matching query digest",
+			URL:            "http://localhost:8080" + blobPath + "?digest=sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e",
+			ExpectedStatus: http.StatusTemporaryRedirect,
+			ExpectedURL:    "https://k8s.gcr.io" + blobPath,
+		},
+		{
+			Name:              "mismatched query digest",
+			URL:               "http://localhost:8080" + blobPath + "?digest=sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa1234567",
+			ExpectedStatus:    http.StatusBadRequest,
+			ExpectedErrorCode: errCodeDigestInvalid,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			recorder := httptest.NewRecorder()
+			handler(recorder, httptest.NewRequest("GET", tc.URL, nil))
+			response := recorder.Result()
+			if response.StatusCode != tc.ExpectedStatus {
+				t.Fatalf("expected status: %d, but got status: %d", tc.ExpectedStatus, response.StatusCode)
+			}
+			if location := response.Header.Get("Location"); location != tc.ExpectedURL {
+				t.Fatalf("expected url: %q, but got: %q", tc.ExpectedURL, location)
+			}
+			if tc.ExpectedErrorCode != "" {
+				assertOCIErrorCode(t, response, tc.ExpectedErrorCode)
+			}
+		})
+	}
+}
+
+func TestMakeV2HandlerDigestAlgorithms(t *testing.T) {
+	const sha256Path = "/v2/pause/blobs/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	const sha512Path = "/v2/pause/blobs/sha512:3c3a4d5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a0b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a0b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e"
+	const sha1Path = "/v2/pause/blobs/sha1:2fd4e1c67a2d28fced849ee1bb76e7391b93eb12"
+	testCases := []struct {
+		Name              string
+		Allowed           []string
+		Path              string
+		ExpectedStatus    int
+		ExpectedErrorCode string
+	}{
+		{
+			Name:           "default allows sha256",
+			Path:           sha256Path,
+			ExpectedStatus: http.StatusTemporaryRedirect,
+		},
+		{
+			Name:           "default allows sha512",
+			Path:           sha512Path,
+			ExpectedStatus: http.StatusTemporaryRedirect,
+		},
+		{
+			Name:              "default rejects sha1",
+			Path:              sha1Path,
+			ExpectedStatus:    http.StatusBadRequest,
+			ExpectedErrorCode: errCodeDigestInvalid,
+		},
+		{
+			Name:           "configured allows sha1",
+			Allowed:        []string{"sha256", "sha1"},
+			Path:           sha1Path,
+			ExpectedStatus: http.StatusTemporaryRedirect,
+		},
+		{
+			Name:              "configured rejects sha512",
+			Allowed:           []string{"sha256"},
+			Path:              sha512Path,
+			ExpectedStatus:    http.StatusBadRequest,
+			ExpectedErrorCode: errCodeDigestInvalid,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			registryConfig := RegistryConfig{
+				UpstreamRegistryEndpoint: "https://k8s.gcr.io",
+				AllowedDigestAlgorithms:  tc.Allowed,
+			}
+			handler := makeV2Handler(context.Background(), registryConfig, &fakeBlobsChecker{}, &fakeBlobProxy{}, nil, nil, nil)
+			recorder := httptest.NewRecorder()
+			handler(recorder, httptest.NewRequest("GET", "http://localhost:8080"+tc.Path, nil))
+			response := recorder.Result()
+			if response.StatusCode != tc.ExpectedStatus {
+				t.Fatalf("expected status: %d, but got status: %d", tc.ExpectedStatus, response.StatusCode)
+			}
+			if tc.ExpectedErrorCode != "" {
+				assertOCIErrorCode(t, response, tc.ExpectedErrorCode)
+			}
+		})
+	}
+}
+
+// assertOCIErrorCode checks that response is an OCI error response with code
+func assertOCIErrorCode(t *testing.T, response *http.Response, code string) {
+	t.Helper()
+	if contentType := response.Header.Get("Content-Type"); contentType != "application/json" {
+		t.Fatalf("expected JSON error response, got Content-Type: %q", contentType)
+	}
+	errResponse := ociErrorResponse{}
+	if err := json.NewDecoder(response.Body).Decode(&errResponse); err != nil {
+		t.Fatalf("failed to decode error response: %v", err)
+	}
+	if len(errResponse.Errors) != 1 || errResponse.Errors[0].Code != code {
+		t.Fatalf("expected error code: %q, but got: %+v", code, errResponse.Errors)
+	}
+}
+
+func TestMakeV2HandlerBlobAlternateLinks(t *testing.T) {
+	registryConfig := RegistryConfig{
+		UpstreamRegistryEndpoint: "https://k8s.gcr.io",
+		BlobAlternateLinks:       2,
+	}
+	const digest = "sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	blobs := &fakeBlobsChecker{
+		knownURLs: map[string]bool{
+			awsRegionToHostURL("eu-west-3", "") + "/containers/images/" + digest: true,
+		},
+	}
+	handler := makeV2Handler(context.Background(), registryConfig, blobs, &fakeBlobProxy{}, nil, nil, nil)
+	r := httptest.NewRequest("GET", "http://localhost:8080/v2/pause/blobs/"+digest, nil)
+	r.RemoteAddr = "35.180.1.1:888"
+	recorder := httptest.NewRecorder()
+	handler(recorder, r)
+	response := recorder.Result()
+	if response.StatusCode != http.StatusTemporaryRedirect {
+		t.Fatalf("expected status: %d, but got status: %d", http.StatusTemporaryRedirect, response.StatusCode)
+	}
+	expected := []string{
+		"<" + awsRegionToHostURL("eu-central-1", "") + "/containers/images/" + digest + `>; rel="alternate"`,
+		"<" + awsRegionToHostURL("eu-central-2", "") + "/containers/images/" + digest + `>; rel="alternate"`,
+	}
+	if links := response.Header.Values("Link"); !reflect.DeepEqual(links, expected) {
+		t.Fatalf("expected Link headers: %v, but got: %v", expected, links)
+	}
+}
+
+func TestRegistryConfigMarshalLog(t *testing.T) {
+	rc := RegistryConfig{UpstreamRegistryEndpoint: "https://k8s.gcr.io", AdminToken: testAdminToken}
+	logged := fmt.Sprintf("%+v", rc.MarshalLog())
+	if strings.Contains(logged, testAdminToken) {
+		t.Fatalf("expected admin token to be redacted, got: %s", logged)
+	}
+	if !strings.Contains(logged, rc.UpstreamRegistryEndpoint) {
+		t.Fatalf("expected config to be logged, got: %s", logged)
+	}
+	if logged := fmt.Sprintf("%+v", RegistryConfig{}.MarshalLog()); strings.Contains(logged, "REDACTED") {
+		t.Fatalf("expected empty admin token to be left alone, got: %s", logged)
+	}
+}
+
+func TestMakeHandlerAdmin(t *testing.T) {
+	handler := MakeHandler(RegistryConfig{AdminToken: testAdminToken})
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newAdminRequest("GET", "/admin/slowest", testAdminToken))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status: %d, but got status: %d", http.StatusOK, recorder.Code)
+	}
+}
+
+func TestMakeV2HandlerBackendKeySuffix(t *testing.T) {
+	const digest = "sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	euWest3Bucket := awsRegionToHostURL("eu-west-3", "")
+	euWest1Bucket := awsRegionToHostURL("eu-west-1", "")
+	registryConfig := RegistryConfig{
+		UpstreamRegistryEndpoint: "https://k8s.gcr.io",
+		Backends: map[string]BackendConfig{
+			euWest3Bucket: {KeySuffix: "?versionId=locked"},
+		},
+	}
+	blobs := &fakeBlobsChecker{
+		knownURLs: map[string]bool{
+			euWest3Bucket + "/containers/images/" + digest + "?versionId=locked": true,
+			euWest1Bucket + "/containers/images/" + digest:                       true,
+		},
+	}
+	handler := makeV2Handler(context.Background(), registryConfig, blobs, &fakeBlobProxy{}, nil, nil, nil)
+	testCases := []struct {
+		Name        string
+		RemoteAddr  string
+		ExpectedURL string
+	}{
+		{
+			Name:        "backend with key suffix",
+			RemoteAddr:  "35.180.1.1:888",
+			ExpectedURL: euWest3Bucket + "/containers/images/" + digest + "?versionId=locked",
+		},
+		{
+			Name:        "default backend",
+			RemoteAddr:  "52.208.1.1:888",
+			ExpectedURL: euWest1Bucket + "/containers/images/" + digest,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			r := httptest.NewRequest("GET", "http://localhost:8080/v2/pause/blobs/"+digest, nil)
+			r.RemoteAddr = tc.RemoteAddr
+			recorder := httptest.NewRecorder()
+			handler(recorder, r)
+			response := recorder.Result()
+			if response.StatusCode != http.StatusTemporaryRedirect {
+				t.Fatalf("expected status: %d, but got status: %d", http.StatusTemporaryRedirect, response.StatusCode)
+			}
+			if location := response.Header.Get("Location"); location != tc.ExpectedURL {
+				t.Fatalf("expected url: %q, but got: %q", tc.ExpectedURL, location)
+			}
+		})
+	}
+}
+
+func TestMakeV2HandlerBackendForwardQuery(t *testing.T) {
+	const digest = "sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	euWest3Bucket := awsRegionToHostURL("eu-west-3", "")
+	euWest1Bucket := awsRegionToHostURL("eu-west-1", "")
+	usEast1Bucket := awsRegionToHostURL("us-east-1", "")
+	registryConfig := RegistryConfig{
+		UpstreamRegistryEndpoint: "https://k8s.gcr.io",
+		Backends: map[string]BackendConfig{
+			euWest3Bucket: {ForwardQuery: true},
+			usEast1Bucket: {ForwardQuery: true, KeySuffix: "?versionId=locked"},
+		},
+	}
+	blobs := &fakeBlobsChecker{
+		knownURLs: map[string]bool{
+			euWest3Bucket + "/containers/images/" + digest:                       true,
+			euWest1Bucket + "/containers/images/" + digest:                       true,
+			usEast1Bucket + "/containers/images/" + digest + "?versionId=locked": true,
+		},
+	}
+	handler := makeV2Handler(context.Background(), registryConfig, blobs, &fakeBlobProxy{}, nil, nil, nil)
+	testCases := []struct {
+		Name        string
+		RemoteAddr  string
+		Query       string
+		ExpectedURL string
+	}{
+		{
+			Name:        "forward query",
+			RemoteAddr:  "35.180.1.1:888",
+			Query:       "?token=abc",
+			ExpectedURL: euWest3Bucket + "/containers/images/" + digest + "?token=abc",
+		},
+		{
+			Name:        "forward empty query",
+			RemoteAddr:  "35.180.1.1:888",
+			ExpectedURL: euWest3Bucket + "/containers/images/" + digest,
+		},
+		{
+			Name:        "forward query with key suffix",
+			RemoteAddr:  "52.93.127.172:888",
+			Query:       "?token=abc",
+			ExpectedURL: usEast1Bucket + "/containers/images/" + digest + "?versionId=locked&token=abc",
+		},
+		{
+			Name:        "strip query",
+			RemoteAddr:  "52.208.1.1:888",
+			Query:       "?token=abc",
+			ExpectedURL: euWest1Bucket + "/containers/images/" + digest,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			r := httptest.NewRequest("GET", "http://localhost:8080/v2/pause/blobs/"+digest+tc.Query, nil)
+			r.RemoteAddr = tc.RemoteAddr
+			recorder := httptest.NewRecorder()
+			handler(recorder, r)
+			response := recorder.Result()
+			if response.StatusCode != http.StatusTemporaryRedirect {
+				t.Fatalf("expected status: %d, but got status: %d", http.StatusTemporaryRedirect, response.StatusCode)
+			}
+			if location := response.Header.Get("Location"); location != tc.ExpectedURL {
+				t.Fatalf("expected url: %q, but got: %q", tc.ExpectedURL, location)
+			}
+		})
+	}
+}
+
+// blockingBlobsChecker counts checks, which block until release is closed
+type blockingBlobsChecker struct {
+	calls   atomic.Int32
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingBlobsChecker) BlobExists(_ context.Context, _ string) (bool, error) {
+	if b.calls.Add(1) == 1 {
+		close(b.started)
+	}
+	<-b.release
+	return true, nil
+}
+
+func TestMakeV2HandlerCoalescesConcurrentRequests(t *testing.T) {
+	t.Parallel()
+	const requests = 5
+	joined := make(chan struct{}, requests)
+	inflight := newLookupGroup(func() { joined <- struct{}{} })
+	registryConfig := RegistryConfig{
+		UpstreamRegistryEndpoint: "https://k8s.gcr.io",
+	}
+	blobs := &blockingBlobsChecker{
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	handler := makeV2Handler(context.Background(), registryConfig, blobs, &fakeBlobProxy{}, nil, nil, inflight)
+	const blobURL = "https://prod-registry-k8s-io-eu-west-1.s3.dualstack.eu-west-1.amazonaws.com/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	locations := make(chan string, requests)
+	serve := func() {
+		r := httptest.NewRequest("GET", "http://localhost:8080/v2/pause/blobs/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e", nil)
+		r.RemoteAddr = "52.208.1.1:888"
+		recorder := httptest.NewRecorder()
+		handler(recorder, r)
+		locations <- recorder.Result().Header.Get("Location")
+	}
+	go serve()
+	<-blobs.started
+	for i := 1; i < requests; i++ {
+		go serve()
+	}
+	// release the check only once every duplicate has joined it
+	for i := 1; i < requests; i++ {
+		<-joined
+	}
+	close(blobs.release)
+	for i := 0; i < requests; i++ {
+		if location := <-locations; location != blobURL {
+			t.Fatalf("expected url: %q, but got: %q", blobURL, location)
+		}
+	}
+	if calls := blobs.calls.Load(); calls != 1 {
+		t.Fatalf("expected one blob check, but got: %d", calls)
+	}
+	// once complete, requests are checked again
+	serve()
+	if calls := blobs.calls.Load(); calls != 2 {
+		t.Fatalf("expected a second blob check, but got: %d", calls)
+	}
+}
+
+func TestMakeV2HandlerRegionLastServe(t *testing.T) {
+	const blobPath = "/v2/pause/blobs/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	registryConfig := RegistryConfig{
+		UpstreamRegistryEndpoint: "https://k8s.gcr.io",
+		DefaultAWSBaseURL:        "https://default.example.com",
+	}
+	blobs := &fakeBlobsChecker{knownURLs: map[string]bool{
+		"https://prod-registry-k8s-io-eu-west-1.s3.dualstack.eu-west-1.amazonaws.com/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e": true,
+		"https://default.example.com/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e":                                                 true,
+	}}
+	handler := makeV2Handler(context.Background(), registryConfig, blobs, &fakeBlobProxy{}, nil, nil, nil)
+	serve := func(remoteAddr string) {
+		r := httptest.NewRequest("GET", "http://localhost:8080"+blobPath, nil)
+		r.RemoteAddr = remoteAddr
+		handler(httptest.NewRecorder(), r)
+	}
+	lastServe := func(region string) float64 {
+		return testutil.ToFloat64(regionLastServeTimestampSeconds.WithLabelValues(region))
+	}
+
+	// clients redirected to AWS update their region
+	start := float64(time.Now().Unix())
+	serve("52.208.1.1:888")
+	if actual := lastServe("eu-west-1"); actual < start {
+		t.Fatalf("expected eu-west-1 last serve to be updated to at least %v, got: %v", start, actual)
+	}
+	serve("192.0.2.1:888")
+	if actual := lastServe("unknown"); actual < start {
+		t.Fatalf("expected unknown region last serve to be updated to at least %v, got: %v", start, actual)
+	}
+	// clients sent upstream do not
+	before := lastServe("us-east-1")
+	serve("52.93.127.172:888")
+	serve("35.220.26.1:888")
+	if actual := lastServe("us-east-1"); actual != before {
+		t.Fatalf("expected us-east-1 last serve to be unchanged at %v, got: %v", before, actual)
+	}
+	if actual := lastServe("europe-north1"); actual != 0 {
+		t.Fatalf("expected no last serve for GCP region, got: %v", actual)
+	}
+}
+
+func TestMakeV2HandlerRegionLastServeBucketRegion(t *testing.T) {
+	// not parallel, checks global metrics
+	const blobPath = "/v2/pause/blobs/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	const euWest3BlobURL = "https://prod-registry-k8s-io-eu-west-3.s3.dualstack.eu-west-3.amazonaws.com/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	registryConfig := RegistryConfig{
+		UpstreamRegistryEndpoint: "https://k8s.gcr.io",
+		CostAwareRouting:         true,
+		CostWeight:               1,
+		EgressCostPerGB:          map[string]float64{"eu-west-1": 0.09, "eu-west-3": 0.02},
+	}
+	blobs := &fakeBlobsChecker{knownURLs: map[string]bool{euWest3BlobURL: true}}
+	handler := makeV2Handler(context.Background(), registryConfig, blobs, &fakeBlobProxy{}, nil, nil, nil)
+	lastServe := func(region string) float64 {
+		return testutil.ToFloat64(regionLastServeTimestampSeconds.WithLabelValues(region))
+	}
+	clientRegionBefore := lastServe("eu-west-1")
+	start := float64(time.Now().Unix())
+	// an eu-west-1 client served from the cheaper eu-west-3 bucket
+	r := httptest.NewRequest("GET", "http://localhost:8080"+blobPath, nil)
+	r.RemoteAddr = "52.208.1.1:888"
+	recorder := httptest.NewRecorder()
+	handler(recorder, r)
+	if location := recorder.Result().Header.Get("Location"); location != euWest3BlobURL {
+		t.Fatalf("expected url: %q, but got: %q", euWest3BlobURL, location)
+	}
+	if actual := lastServe("eu-west-3"); actual < start {
+		t.Fatalf("expected eu-west-3 last serve to be updated to at least %v, got: %v", start, actual)
+	}
+	if actual := lastServe("eu-west-1"); actual != clientRegionBefore {
+		t.Fatalf("expected client region eu-west-1 last serve to be unchanged at %v, got: %v", clientRegionBefore, actual)
+	}
+}
+
+func TestMakeV2HandlerProtocolBackends(t *testing.T) {
+	const blobPath = "/v2/pause/blobs/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	const euWest1BlobURL = "https://prod-registry-k8s-io-eu-west-1.s3.dualstack.eu-west-1.amazonaws.com/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	const h2BlobURL = "https://h2.example.com/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	blobs := &fakeBlobsChecker{knownURLs: map[string]bool{
+		euWest1BlobURL: true,
+		h2BlobURL:      true,
+	}}
+	registryConfig := RegistryConfig{
+		UpstreamRegistryEndpoint: "https://k8s.gcr.io",
+		ProtocolBackends: map[string]string{
+			"h2": "https://h2.example.com",
+			// does not have the blob
+			"http/1.1": "https://http1.example.com",
+		},
+	}
+	handler := makeV2Handler(context.Background(), registryConfig, blobs, &fakeBlobProxy{}, nil, nil, nil)
+	testCases := []struct {
+		Name        string
+		TLS         *tls.ConnectionState
+		ExpectedURL string
+	}{
+		{
+			Name:        "no TLS",
+			ExpectedURL: euWest1BlobURL,
+		},
+		{
+			Name:        "no protocol negotiated",
+			TLS:         &tls.ConnectionState{},
+			ExpectedURL: euWest1BlobURL,
+		},
+		{
+			Name:        "h2 prefers its backend",
+			TLS:         &tls.ConnectionState{NegotiatedProtocol: "h2"},
+			ExpectedURL: h2BlobURL,
+		},
+		{
+			Name:        "http/1.1 backend without the blob falls back",
+			TLS:         &tls.ConnectionState{NegotiatedProtocol: "http/1.1"},
+			ExpectedURL: euWest1BlobURL,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			r := httptest.NewRequest("GET", "http://localhost:8080"+blobPath, nil)
+			r.RemoteAddr = "52.208.1.1:888"
+			r.TLS = tc.TLS
+			recorder := httptest.NewRecorder()
+			handler(recorder, r)
+			if location := recorder.Result().Header.Get("Location"); location != tc.ExpectedURL {
+				t.Fatalf("expected redirect to: %q, but got: %q", tc.ExpectedURL, location)
+			}
+		})
+	}
+}
+
+func TestMakeV2HandlerRedirectStatusOverrides(t *testing.T) {
+	const digest = "sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	const euWest1BlobURL = "https://prod-registry-k8s-io-eu-west-1.s3.dualstack.eu-west-1.amazonaws.com/containers/images/" + digest
+	registryConfig := RegistryConfig{
+		UpstreamRegistryEndpoint: "https://k8s.gcr.io",
+		RedirectStatusOverrides: map[string]int{
+			"legacy": http.StatusFound,
+		},
+	}
+	blobs := &fakeBlobsChecker{knownURLs: map[string]bool{euWest1BlobURL: true}}
+	handler := makeV2Handler(context.Background(), registryConfig, blobs, &fakeBlobProxy{}, nil, nil, nil)
+	testCases := []struct {
+		Name           string
+		Path           string
+		RemoteAddr     string
+		ExpectedStatus int
+	}{
+		{
+			Name:           "overridden repo manifest",
+			Path:           "/v2/legacy/manifests/latest",
+			ExpectedStatus: http.StatusFound,
+		},
+		{
+			Name:           "overridden repo nested manifest",
+			Path:           "/v2/legacy/pause/manifests/latest",
+			ExpectedStatus: http.StatusFound,
+		},
+		{
+			Name:           "overridden repo AWS blob",
+			Path:           "/v2/legacy/blobs/" + digest,
+			RemoteAddr:     "52.208.1.1:888",
+			ExpectedStatus: http.StatusFound,
+		},
+		{
+			Name:           "overridden repo GCP blob",
+			Path:           "/v2/legacy/blobs/" + digest,
+			RemoteAddr:     "35.220.26.1:888",
+			ExpectedStatus: http.StatusFound,
+		},
+		{
+			Name:           "overridden repo upstream fallback blob",
+			Path:           "/v2/legacy/blobs/" + digest,
+			RemoteAddr:     "127.0.0.1:888",
+			ExpectedStatus: http.StatusFound,
+		},
+		{
+			Name:           "other repo manifest",
+			Path:           "/v2/pause/manifests/latest",
+			ExpectedStatus: http.StatusTemporaryRedirect,
+		},
+		{
+			Name:           "other repo sharing a name prefix",
+			Path:           "/v2/legacy-new/manifests/latest",
+			ExpectedStatus: http.StatusTemporaryRedirect,
+		},
+		{
+			Name:           "other repo AWS blob",
+			Path:           "/v2/pause/blobs/" + digest,
+			RemoteAddr:     "52.208.1.1:888",
+			ExpectedStatus: http.StatusTemporaryRedirect,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			r := httptest.NewRequest("GET", "http://localhost:8080"+tc.Path, nil)
+			if tc.RemoteAddr != "" {
+				r.RemoteAddr = tc.RemoteAddr
+			}
+			recorder := httptest.NewRecorder()
+			handler(recorder, r)
+			if status := recorder.Result().StatusCode; status != tc.ExpectedStatus {
+				t.Fatalf("expected status: %d, but got status: %d", tc.ExpectedStatus, status)
+			}
+		})
+	}
+}
+
+func TestMakeV2HandlerNestedVerbs(t *testing.T) {
+	registryConfig := RegistryConfig{
+		UpstreamRegistryEndpoint: "https://k8s.gcr.io",
+	}
+	handler := makeV2Handler(context.Background(), registryConfig, &fakeBlobsChecker{}, &fakeBlobProxy{}, nil, nil, nil)
+	const digest = "sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	testCases := []struct {
+		Name string
+		Path string
+	}{
+		{Name: "blob under manifest", Path: "/v2/pause/manifests/" + digest + "/blobs/" + digest},
+		{Name: "manifest under blob", Path: "/v2/pause/blobs/" + digest + "/manifests/latest"},
+		{Name: "blob under tags", Path: "/v2/pause/tags/list/blobs/" + digest},
+		{Name: "referrers under manifest", Path: "/v2/pause/manifests/latest/referrers/" + digest},
+		{Name: "trailing component after manifest", Path: "/v2/pause/manifests/latest/extra"},
+		{Name: "missing repository", Path: "/v2/blobs/" + digest},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			r := httptest.NewRequest("GET", "http://localhost:8080"+tc.Path, nil)
+			r.RemoteAddr = "52.208.1.1:888"
+			recorder := httptest.NewRecorder()
+			handler(recorder, r)
+			response := recorder.Result()
+			if response.StatusCode != http.StatusBadRequest {
+				t.Fatalf("expected status: %d, but got status: %d", http.StatusBadRequest, response.StatusCode)
+			}
+			assertOCIErrorCode(t, response, errCodeNameInvalid)
+		})
+	}
+}
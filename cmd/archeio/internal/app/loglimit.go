@@ -0,0 +1,82 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/klog/v2"
+)
+
+// errorLogLimiter rate limits error logs caused by requests, so that a flood
+// of bad requests cannot flood the logging pipeline
+//
+// Suppressed lines are counted and periodically summarized by Run.
+// A nil *errorLogLimiter is valid and logs everything.
+type errorLogLimiter struct {
+	limiter    *rate.Limiter
+	suppressed atomic.Int64
+	// these are klog.ErrorS and klog.InfoS, except in tests
+	errorS func(err error, msg string, keysAndValues ...any)
+	infoS  func(msg string, keysAndValues ...any)
+}
+
+func newErrorLogLimiter(limit rate.Limit, burst int) *errorLogLimiter {
+	return &errorLogLimiter{
+		limiter: rate.NewLimiter(limit, burst),
+		errorS:  klog.ErrorS,
+		infoS:   klog.InfoS,
+	}
+}
+
+// ErrorS is klog.ErrorS, unless the rate limit has been exceeded
+func (l *errorLogLimiter) ErrorS(err error, msg string, keysAndValues ...any) {
+	if l == nil {
+		klog.ErrorS(err, msg, keysAndValues...)
+		return
+	}
+	if !l.limiter.Allow() {
+		l.suppressed.Add(1)
+		return
+	}
+	l.errorS(err, msg, keysAndValues...)
+}
+
+// Run logs how many lines were suppressed every interval until ctx is done
+func (l *errorLogLimiter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			l.summarize()
+			return
+		case <-ticker.C:
+			l.summarize()
+		}
+	}
+}
+
+// summarize logs how many lines were suppressed since it was last called
+func (l *errorLogLimiter) summarize() {
+	if suppressed := l.suppressed.Swap(0); suppressed > 0 {
+		l.infoS("suppressed error logs exceeding rate limit", "count", suppressed)
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordedLogs records log lines from an errorLogLimiter
+type recordedLogs struct {
+	mu         sync.Mutex
+	errors     []string
+	summaries  []int64
+	summarized chan struct{}
+}
+
+func newTestErrorLogLimiter(burst int) (*errorLogLimiter, *recordedLogs) {
+	// no refill, so exactly burst lines are allowed
+	l := newErrorLogLimiter(0, burst)
+	logs := &recordedLogs{summarized: make(chan struct{}, 10)}
+	l.errorS = func(_ error, msg string, _ ...any) {
+		logs.mu.Lock()
+		defer logs.mu.Unlock()
+		logs.errors = append(logs.errors, msg)
+	}
+	l.infoS = func(_ string, keysAndValues ...any) {
+		logs.mu.Lock()
+		defer logs.mu.Unlock()
+		logs.summaries = append(logs.summaries, keysAndValues[1].(int64))
+		logs.summarized <- struct{}{}
+	}
+	return l, logs
+}
+
+func TestErrorLogLimiter(t *testing.T) {
+	l, logs := newTestErrorLogLimiter(3)
+	for i := 0; i < 10; i++ {
+		l.ErrorS(errors.New("bad request"), "failed to get client IP")
+	}
+	if len(logs.errors) != 3 {
+		t.Fatalf("expected 3 lines to be logged, got: %v", logs.errors)
+	}
+	l.summarize()
+	if len(logs.summaries) != 1 || logs.summaries[0] != 7 {
+		t.Fatalf("expected a summary of 7 suppressed lines, got: %v", logs.summaries)
+	}
+	// nothing more was suppressed, so nothing to summarize
+	l.summarize()
+	if len(logs.summaries) != 1 {
+		t.Fatalf("expected no further summaries, got: %v", logs.summaries)
+	}
+}
+
+func TestErrorLogLimiterRun(t *testing.T) {
+	l, logs := newTestErrorLogLimiter(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.Run(ctx, time.Millisecond)
+	}()
+	// summarized periodically
+	l.ErrorS(nil, "first")
+	<-logs.summarized
+	// and when stopped
+	l.ErrorS(nil, "second")
+	l.ErrorS(nil, "third")
+	cancel()
+	<-done
+	logs.mu.Lock()
+	defer logs.mu.Unlock()
+	total := int64(0)
+	for _, suppressed := range logs.summaries {
+		total += suppressed
+	}
+	if len(logs.errors) != 0 || total != 3 {
+		t.Fatalf("expected 3 suppressed lines to be summarized, got errors: %v, summaries: %v", logs.errors, logs.summaries)
+	}
+}
+
+func TestErrorLogLimiterNil(t *testing.T) {
+	var l *errorLogLimiter
+	// should log normally
+	l.ErrorS(errors.New("bad request"), "failed to get client IP")
+}
+
+func TestMakeV2HandlerErrorLogQPS(t *testing.T) {
+	registryConfig := RegistryConfig{
+		UpstreamRegistryEndpoint: "https://k8s.gcr.io",
+		ErrorLogQPS:              1,
+	}
+	handler := makeV2Handler(context.Background(), registryConfig, &fakeBlobsChecker{}, &fakeBlobProxy{}, nil, nil, nil)
+	for i := 0; i < 5; i++ {
+		r := httptest.NewRequest("GET", "http://localhost:8080/v2/pause/blobs/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e", nil)
+		r.Header.Set("X-Forwarded-For", "bogus")
+		recorder := httptest.NewRecorder()
+		handler(recorder, r)
+		// requests are still rejected as normal
+		if recorder.Code != http.StatusBadRequest {
+			t.Fatalf("expected status: %d, but got status: %d", http.StatusBadRequest, recorder.Code)
+		}
+	}
+}
+
+func TestMakeV2HandlerErrorLogQPSBackgroundPool(t *testing.T) {
+	t.Parallel()
+	pool := newWorkerPool(1, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	registryConfig := RegistryConfig{
+		UpstreamRegistryEndpoint: "https://k8s.gcr.io",
+		ErrorLogQPS:              1,
+		BackgroundPool:           pool,
+	}
+	makeV2Handler(ctx, registryConfig, &fakeBlobsChecker{}, &fakeBlobProxy{}, nil, nil, nil)
+	// the summary loop runs for the life of the handler, so must not hold a
+	// worker other background tasks need
+	if running := pool.Running(); running != 0 {
+		t.Fatalf("expected the error log summary not to hold pool workers, got %d", running)
+	}
+	if !pool.Submit(func() {}) {
+		t.Fatal("expected the pool to have room for short tasks")
+	}
+}
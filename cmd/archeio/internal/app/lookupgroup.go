@@ -0,0 +1,88 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import "sync"
+
+// blobLookup is the result of checking candidate buckets for a blob
+type blobLookup struct {
+	// bucketURL is the first candidate found to have the blob, "" if none
+	bucketURL string
+	// unprobed are the candidates left unchecked, in order, as the fallback
+	// probe budget was exhausted
+	unprobed []string
+	// failed is set if any candidate checked could not say either way
+	failed bool
+}
+
+// lookupGroup coalesces identical concurrent blob lookups, like
+// singleflight.Group, but typed and with a hook for duplicate callers
+//
+// A nil *lookupGroup does not coalesce, calling fn for every lookup.
+type lookupGroup struct {
+	// joined, if set, is called whenever a lookup joins an identical lookup
+	// already in flight, so tests can wait for duplicates deterministically
+	joined func()
+
+	mu    sync.Mutex
+	calls map[string]*lookupCall
+}
+
+type lookupCall struct {
+	wg  sync.WaitGroup
+	val blobLookup
+}
+
+func newLookupGroup(joined func()) *lookupGroup {
+	return &lookupGroup{
+		joined: joined,
+		calls:  make(map[string]*lookupCall),
+	}
+}
+
+// Do calls fn and returns its result, unless a lookup for key is already in
+// flight, in which case it waits for and returns that result instead
+//
+// If fn panics, waiting callers get the zero value and later lookups for key
+// call fn again.
+func (g *lookupGroup) Do(key string, fn func() blobLookup) blobLookup {
+	if g == nil {
+		return fn()
+	}
+	g.mu.Lock()
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		if g.joined != nil {
+			g.joined()
+		}
+		c.wg.Wait()
+		return c.val
+	}
+	c := &lookupCall{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		c.wg.Done()
+	}()
+
+	c.val = fn()
+	return c.val
+}
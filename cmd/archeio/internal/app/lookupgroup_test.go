@@ -0,0 +1,99 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"testing"
+)
+
+func TestLookupGroup(t *testing.T) {
+	t.Parallel()
+	joined := make(chan struct{})
+	g := newLookupGroup(func() { close(joined) })
+	release := make(chan struct{})
+	first := make(chan blobLookup)
+	go func() {
+		first <- g.Do("key", func() blobLookup {
+			<-release
+			return blobLookup{bucketURL: "first"}
+		})
+	}()
+	// wait for the first lookup to be in flight
+	for {
+		g.mu.Lock()
+		_, inFlight := g.calls["key"]
+		g.mu.Unlock()
+		if inFlight {
+			break
+		}
+	}
+	duplicate := make(chan blobLookup)
+	go func() {
+		duplicate <- g.Do("key", func() blobLookup {
+			t.Error("expected the duplicate lookup to be coalesced")
+			return blobLookup{bucketURL: "duplicate"}
+		})
+	}()
+	<-joined
+	// other keys are not coalesced
+	if val := g.Do("other", func() blobLookup { return blobLookup{bucketURL: "other"} }); val.bucketURL != "other" {
+		t.Fatalf("expected: %q, but got: %q", "other", val.bucketURL)
+	}
+	close(release)
+	if val := <-first; val.bucketURL != "first" {
+		t.Fatalf("expected: %q, but got: %q", "first", val.bucketURL)
+	}
+	if val := <-duplicate; val.bucketURL != "first" {
+		t.Fatalf("expected the duplicate to share: %q, but got: %q", "first", val.bucketURL)
+	}
+	// once complete, lookups run again
+	g.joined = nil
+	if val := g.Do("key", func() blobLookup { return blobLookup{bucketURL: "again"} }); val.bucketURL != "again" {
+		t.Fatalf("expected: %q, but got: %q", "again", val.bucketURL)
+	}
+}
+
+func TestLookupGroupPanic(t *testing.T) {
+	t.Parallel()
+	g := newLookupGroup(nil)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected the lookup panic to propagate")
+			}
+		}()
+		g.Do("key", func() blobLookup { panic("lookup failed") })
+	}()
+	// the failed lookup is no longer in flight, so does not block others
+	if val := g.Do("key", func() blobLookup { return blobLookup{bucketURL: "again"} }); val.bucketURL != "again" {
+		t.Fatalf("expected: %q, but got: %q", "again", val.bucketURL)
+	}
+}
+
+func TestLookupGroupNil(t *testing.T) {
+	t.Parallel()
+	var g *lookupGroup
+	calls := 0
+	for i := 0; i < 2; i++ {
+		if val := g.Do("key", func() blobLookup { calls++; return blobLookup{bucketURL: "val"} }); val.bucketURL != "val" {
+			t.Fatalf("expected: %q, but got: %q", "val", val.bucketURL)
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("expected every lookup to be called, but got: %d calls", calls)
+	}
+}
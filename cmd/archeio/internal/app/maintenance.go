@@ -0,0 +1,96 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maintenanceWindow warns clients about scheduled maintenance with a
+// Warning header on successful responses, without otherwise changing them
+//
+// A zero start or end leaves the window open on that side.
+type maintenanceWindow struct {
+	message    string
+	start, end time.Time
+	now        func() time.Time
+}
+
+func newMaintenanceWindow(message string, start, end time.Time) *maintenanceWindow {
+	return &maintenanceWindow{
+		message: message,
+		start:   start,
+		end:     end,
+		now:     time.Now,
+	}
+}
+
+// Active returns true if we are within the window
+func (m *maintenanceWindow) Active() bool {
+	now := m.now()
+	return !now.Before(m.start) && (m.end.IsZero() || now.Before(m.end))
+}
+
+// Wrap returns next with the Warning header added while the window is active
+func (m *maintenanceWindow) Wrap(next http.Handler) http.Handler {
+	if m.message == "" {
+		return next
+	}
+	// 199 is "Miscellaneous Warning", the agent is unknown
+	// https://www.rfc-editor.org/rfc/rfc7234#section-5.5
+	warning := `199 - "` + warnTextEscaper.Replace(m.message) + `"`
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.Active() {
+			w = &warningResponseWriter{ResponseWriter: w, warning: warning}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// warnTextEscaper escapes a message as a Warning header quoted-string
+var warnTextEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// warningResponseWriter adds a Warning header to non-error responses
+type warningResponseWriter struct {
+	http.ResponseWriter
+	warning     string
+	wroteHeader bool
+}
+
+func (w *warningResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if status < http.StatusBadRequest {
+			w.Header().Add("Warning", w.warning)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *warningResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (w *warningResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceWindowWrap(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(2 * time.Hour)
+	const expectedWarning = `199 - "registry maintenance \"today\""`
+	testCases := []struct {
+		Name            string
+		Message         string
+		Start, End      time.Time
+		Now             time.Time
+		Status          int
+		ExpectedWarning string
+	}{
+		{
+			Name:    "before window",
+			Message: `registry maintenance "today"`,
+			Start:   start,
+			End:     end,
+			Now:     start.Add(-time.Second),
+			Status:  http.StatusTemporaryRedirect,
+		},
+		{
+			Name:            "window start",
+			Message:         `registry maintenance "today"`,
+			Start:           start,
+			End:             end,
+			Now:             start,
+			Status:          http.StatusTemporaryRedirect,
+			ExpectedWarning: expectedWarning,
+		},
+		{
+			Name:            "within window",
+			Message:         `registry maintenance "today"`,
+			Start:           start,
+			End:             end,
+			Now:             start.Add(time.Hour),
+			Status:          http.StatusOK,
+			ExpectedWarning: expectedWarning,
+		},
+		{
+			Name:    "window end",
+			Message: `registry maintenance "today"`,
+			Start:   start,
+			End:     end,
+			Now:     end,
+			Status:  http.StatusTemporaryRedirect,
+		},
+		{
+			Name:    "within window, error response",
+			Message: `registry maintenance "today"`,
+			Start:   start,
+			End:     end,
+			Now:     start.Add(time.Hour),
+			Status:  http.StatusNotFound,
+		},
+		{
+			Name:            "open ended window",
+			Message:         `registry maintenance "today"`,
+			Start:           start,
+			Now:             end.Add(time.Hour),
+			Status:          http.StatusTemporaryRedirect,
+			ExpectedWarning: expectedWarning,
+		},
+		{
+			Name:            "no window",
+			Message:         `registry maintenance "today"`,
+			Now:             start,
+			Status:          http.StatusOK,
+			ExpectedWarning: expectedWarning,
+		},
+		{
+			Name:   "no message",
+			Start:  start,
+			End:    end,
+			Now:    start.Add(time.Hour),
+			Status: http.StatusOK,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			m := newMaintenanceWindow(tc.Message, tc.Start, tc.End)
+			m.now = func() time.Time { return tc.Now }
+			handler := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.Status)
+				// a second call must not add the header again
+				w.WriteHeader(tc.Status)
+			}))
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest("GET", "http://localhost:8080/v2/", nil))
+			if recorder.Code != tc.Status {
+				t.Fatalf("expected status: %d, but got status: %d", tc.Status, recorder.Code)
+			}
+			warnings := recorder.Header().Values("Warning")
+			switch {
+			case tc.ExpectedWarning == "" && len(warnings) != 0:
+				t.Fatalf("expected no Warning header, got: %q", warnings)
+			case tc.ExpectedWarning != "" && (len(warnings) != 1 || warnings[0] != tc.ExpectedWarning):
+				t.Fatalf("expected Warning header: %q, got: %q", tc.ExpectedWarning, warnings)
+			}
+		})
+	}
+}
+
+func TestWarningResponseWriter(t *testing.T) {
+	t.Parallel()
+	recorder := httptest.NewRecorder()
+	w := &warningResponseWriter{ResponseWriter: recorder, warning: `199 - "maintenance"`}
+	// implicit 200 OK
+	if _, err := w.Write([]byte("ok")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := w.Write([]byte("ok")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if warnings := recorder.Header().Values("Warning"); len(warnings) != 1 {
+		t.Fatalf("expected one Warning header, got: %q", warnings)
+	}
+	if body := recorder.Body.String(); body != "okok" {
+		t.Fatalf("expected body %q, got %q", "okok", body)
+	}
+	if w.Unwrap() != recorder {
+		t.Fatal("expected Unwrap to return the underlying writer")
+	}
+}
+
+func TestMakeHandlerMaintenanceWarning(t *testing.T) {
+	t.Parallel()
+	handler := MakeHandler(RegistryConfig{
+		UpstreamRegistryEndpoint: "https://k8s.gcr.io",
+		MaintenanceWarning:       "maintenance in progress",
+	})
+	testCases := []struct {
+		Path          string
+		ExpectWarning bool
+	}{
+		{Path: "/v2/", ExpectWarning: true},
+		{Path: "/v2/pause/manifests/latest", ExpectWarning: true},
+		{Path: "/unknown"},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Path, func(t *testing.T) {
+			t.Parallel()
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest("GET", "http://localhost:8080"+tc.Path, nil))
+			if hasWarning := recorder.Header().Get("Warning") != ""; hasWarning != tc.ExpectWarning {
+				t.Fatalf("expected Warning header: %v, got headers: %v", tc.ExpectWarning, recorder.Header())
+			}
+		})
+	}
+}
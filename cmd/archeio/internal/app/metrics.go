@@ -0,0 +1,108 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics are served from metricsRegistry by MetricsHandler
+var (
+	blobCacheStaleServedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "archeio_blob_cache_stale_served_total",
+		Help: "Blob requests served from an expired blob existence cache entry because the backend could not be reached.",
+	})
+	redirectIgnoredTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "archeio_redirect_ignored_total",
+		Help: "Clients detected repeatedly requesting the same blob, which usually means they are not following redirects.",
+	})
+	blobCacheEntryAgeSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name: "archeio_blob_cache_entry_age_seconds",
+		Help: "Age of blob existence cache entries when used to serve a request.",
+		// 1s to ~3 days
+		Buckets: prometheus.ExponentialBuckets(1, 4, 10),
+		// also exposed as a native histogram to scrapers negotiating protobuf
+		NativeHistogramBucketFactor:    1.1,
+		NativeHistogramMaxBucketNumber: 100,
+	})
+	forwardedForTruncatedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "archeio_forwarded_for_truncated_total",
+		Help: "Requests with more X-Forwarded-For entries than we parse.",
+	})
+	regionLastServeTimestampSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "archeio_region_last_serve_timestamp_seconds",
+		Help: "Unix time a blob request was last served from the AWS bucket in each region.",
+	}, []string{"region"})
+	blobProbeResultsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "archeio_blob_probe_results_total",
+		Help: "Blob existence probes by result: found, not_found, forbidden or error.",
+	}, []string{"result"})
+	fallbackProbesSkippedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "archeio_fallback_probes_skipped_total",
+		Help: "Blob lookups that skipped probing fallback buckets because the fallback probe budget was exhausted.",
+	})
+	probeSlotsExhaustedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "archeio_blob_probe_slots_exhausted_total",
+		Help: "Blob existence probes not made because the backend's concurrent probe limit stayed full.",
+	})
+	blobETagMismatchTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "archeio_blob_etag_mismatch_total",
+		Help: "Blob probes where the backend ETag did not match the requested digest.",
+	})
+)
+
+// blobProbeResultsTotal result label values
+const (
+	probeResultFound     = "found"
+	probeResultNotFound  = "not_found"
+	probeResultForbidden = "forbidden"
+	probeResultError     = "error"
+)
+
+var metricsRegistry = newMetricsRegistry()
+
+func newMetricsRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		blobCacheStaleServedTotal,
+		redirectIgnoredTotal,
+		blobCacheEntryAgeSeconds,
+		forwardedForTruncatedTotal,
+		blobETagMismatchTotal,
+		fallbackProbesSkippedTotal,
+		probeSlotsExhaustedTotal,
+		regionLastServeTimestampSeconds,
+		blobProbeResultsTotal,
+	)
+	return registry
+}
+
+// MetricsHandler returns an HTTP handler serving archeio's Prometheus metrics
+//
+// If openMetrics is set, the OpenMetrics text format is served to scrapers
+// requesting it in their Accept header, otherwise the Prometheus text format.
+func MetricsHandler(openMetrics bool) http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{
+		EnableOpenMetrics: openMetrics,
+	})
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	const openMetricsAccept = "application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5"
+	testCases := []struct {
+		Name                string
+		OpenMetrics         bool
+		Accept              string
+		ExpectedContentType string
+		ExpectEOF           bool
+	}{
+		{
+			Name:                "default",
+			OpenMetrics:         true,
+			ExpectedContentType: "text/plain; version=0.0.4",
+		},
+		{
+			Name:                "OpenMetrics requested",
+			OpenMetrics:         true,
+			Accept:              openMetricsAccept,
+			ExpectedContentType: "application/openmetrics-text; version=1.0.0",
+			ExpectEOF:           true,
+		},
+		{
+			Name:                "OpenMetrics requested but disabled",
+			Accept:              openMetricsAccept,
+			ExpectedContentType: "text/plain; version=0.0.4",
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			r := httptest.NewRequest("GET", "http://localhost:9090/metrics", nil)
+			if tc.Accept != "" {
+				r.Header.Set("Accept", tc.Accept)
+			}
+			recorder := httptest.NewRecorder()
+			MetricsHandler(tc.OpenMetrics).ServeHTTP(recorder, r)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("expected status: %d, but got status: %d", http.StatusOK, recorder.Code)
+			}
+			if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, tc.ExpectedContentType) {
+				t.Fatalf("expected content type %q, got %q", tc.ExpectedContentType, contentType)
+			}
+			body := recorder.Body.String()
+			if !strings.Contains(body, "archeio_blob_cache_stale_served_total") {
+				t.Fatalf("expected archeio metrics to be served, got: %s", body)
+			}
+			// OpenMetrics requires this terminator, Prometheus text has none
+			if hasEOF := strings.HasSuffix(body, "# EOF\n"); hasEOF != tc.ExpectEOF {
+				t.Fatalf("expected # EOF terminator: %v, got body: %s", tc.ExpectEOF, body)
+			}
+		})
+	}
+}
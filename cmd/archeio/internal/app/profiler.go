@@ -0,0 +1,133 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	profilePrefix = "cpu-"
+	profileSuffix = ".pprof"
+	// profileTimeFormat sorts lexically in time order
+	profileTimeFormat = "20060102T150405.000000000Z"
+)
+
+// ProfilerConfig configures periodically capturing CPU profiles to disk
+type ProfilerConfig struct {
+	// Dir is where profiles are written
+	Dir string
+	// Duration is how long each profile runs for
+	Duration time.Duration
+	// Interval is how often profiles are started
+	Interval time.Duration
+	// Keep is how many of the most recent profiles to keep
+	Keep int
+}
+
+// ValidateProfilerConfig returns an error if c would not capture and keep
+// complete profiles
+//
+// Interval must be positive and longer than Duration, so each profile
+// finishes before the next starts, and Keep must be positive, or each new
+// profile would be removed as soon as it is written.
+func ValidateProfilerConfig(c ProfilerConfig) error {
+	var errs []error
+	if c.Duration <= 0 {
+		errs = append(errs, fmt.Errorf("invalid CPU profile duration %v, expected more than 0", c.Duration))
+	}
+	if c.Interval <= 0 {
+		errs = append(errs, fmt.Errorf("invalid CPU profile interval %v, expected more than 0", c.Interval))
+	} else if c.Duration >= c.Interval {
+		errs = append(errs, fmt.Errorf("invalid CPU profile interval %v, expected more than the duration %v", c.Interval, c.Duration))
+	}
+	if c.Keep <= 0 {
+		errs = append(errs, fmt.Errorf("invalid CPU profiles to keep %d, expected more than 0", c.Keep))
+	}
+	return errors.Join(errs...)
+}
+
+// RunProfiler captures a CPU profile every c.Interval until ctx is done,
+// keeping only the most recent c.Keep profiles in c.Dir
+//
+// This is for catching intermittent latency spikes that are hard to catch
+// with on-demand profiling.
+func RunProfiler(ctx context.Context, c ProfilerConfig) {
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+	for {
+		if err := captureProfile(ctx, c); err != nil {
+			klog.ErrorS(err, "failed to capture CPU profile", "dir", c.Dir)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// captureProfile writes one CPU profile to c.Dir and removes old profiles
+func captureProfile(ctx context.Context, c ProfilerConfig) error {
+	name := filepath.Join(c.Dir, profilePrefix+time.Now().UTC().Format(profileTimeFormat)+profileSuffix)
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		os.Remove(name)
+		return err
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(c.Duration):
+	}
+	pprof.StopCPUProfile()
+	return errors.Join(f.Close(), rotateProfiles(c.Dir, c.Keep))
+}
+
+// rotateProfiles removes all but the newest keep profiles in dir
+func rotateProfiles(dir string, keep int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	// entries are sorted by name, and so by time
+	var profiles []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), profilePrefix) && strings.HasSuffix(entry.Name(), profileSuffix) {
+			profiles = append(profiles, entry.Name())
+		}
+	}
+	for len(profiles) > keep {
+		if err := os.Remove(filepath.Join(dir, profiles[0])); err != nil {
+			return err
+		}
+		profiles = profiles[1:]
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"testing"
+	"time"
+)
+
+// NOTE: CPU profiling is process wide, so these tests are not parallel
+
+func TestValidateProfilerConfig(t *testing.T) {
+	testCases := []struct {
+		Name        string
+		Config      ProfilerConfig
+		ExpectError bool
+	}{
+		{
+			Name:   "valid",
+			Config: ProfilerConfig{Duration: 10 * time.Second, Interval: 5 * time.Minute, Keep: 12},
+		},
+		{
+			Name:        "zero duration",
+			Config:      ProfilerConfig{Interval: 5 * time.Minute, Keep: 12},
+			ExpectError: true,
+		},
+		{
+			Name:        "zero interval",
+			Config:      ProfilerConfig{Duration: 10 * time.Second, Keep: 12},
+			ExpectError: true,
+		},
+		{
+			Name:        "negative interval",
+			Config:      ProfilerConfig{Duration: 10 * time.Second, Interval: -time.Minute, Keep: 12},
+			ExpectError: true,
+		},
+		{
+			Name:        "duration as long as interval",
+			Config:      ProfilerConfig{Duration: time.Minute, Interval: time.Minute, Keep: 12},
+			ExpectError: true,
+		},
+		{
+			Name:        "keep none",
+			Config:      ProfilerConfig{Duration: 10 * time.Second, Interval: 5 * time.Minute},
+			ExpectError: true,
+		},
+		{
+			Name:        "keep negative",
+			Config:      ProfilerConfig{Duration: 10 * time.Second, Interval: 5 * time.Minute, Keep: -1},
+			ExpectError: true,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			err := ValidateProfilerConfig(tc.Config)
+			if tc.ExpectError && err == nil {
+				t.Fatal("expected error but got none")
+			} else if !tc.ExpectError && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestRunProfiler(t *testing.T) {
+	dir := t.TempDir()
+	c := ProfilerConfig{
+		Dir:      dir,
+		Duration: 10 * time.Millisecond,
+		Interval: 20 * time.Millisecond,
+		Keep:     2,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		RunProfiler(ctx, c)
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(listProfiles(t, dir)) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	if profiles := listProfiles(t, dir); len(profiles) == 0 || len(profiles) > 2 {
+		t.Fatalf("expected 1-2 profiles, but got: %v", profiles)
+	}
+}
+
+func TestCaptureProfileRotates(t *testing.T) {
+	dir := t.TempDir()
+	// not a profile, should be left alone
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c := ProfilerConfig{
+		Dir:      dir,
+		Duration: time.Millisecond,
+		Keep:     2,
+	}
+	var written []string
+	for i := 0; i < 3; i++ {
+		if err := captureProfile(context.Background(), c); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		profiles := listProfiles(t, dir)
+		written = append(written, profiles[len(profiles)-1])
+	}
+	profiles := listProfiles(t, dir)
+	if len(profiles) != 2 || profiles[0] != written[1] || profiles[1] != written[2] {
+		t.Fatalf("expected newest profiles %v, but got: %v", written[1:], profiles)
+	}
+	for _, profile := range profiles {
+		contents, err := os.ReadFile(profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(contents) == 0 {
+			t.Fatalf("expected profile %q to have contents", profile)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err != nil {
+		t.Fatalf("expected other files to be kept: %v", err)
+	}
+}
+
+func listProfiles(t *testing.T, dir string) []string {
+	t.Helper()
+	profiles, err := filepath.Glob(filepath.Join(dir, profilePrefix+"*"+profileSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return profiles
+}
+
+func TestCaptureProfileErrors(t *testing.T) {
+	c := ProfilerConfig{Dir: filepath.Join(t.TempDir(), "missing"), Interval: time.Hour, Keep: 1}
+	if err := captureProfile(context.Background(), c); err == nil {
+		t.Fatal("expected error for missing profile dir")
+	}
+	if err := rotateProfiles(c.Dir, 1); err == nil {
+		t.Fatal("expected error for missing profile dir")
+	}
+	// errors are only logged, this should still stop once cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	RunProfiler(ctx, c)
+	// only one CPU profile may run at a time
+	c.Dir = t.TempDir()
+	if err := pprof.StartCPUProfile(&bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	err := captureProfile(context.Background(), c)
+	pprof.StopCPUProfile()
+	if err == nil {
+		t.Fatal("expected error while already profiling")
+	}
+	if profiles := listProfiles(t, c.Dir); len(profiles) != 0 {
+		t.Fatalf("expected failed profile to be removed, but got: %v", profiles)
+	}
+	// a directory can't be removed while it has contents
+	stuck := filepath.Join(c.Dir, profilePrefix+"0"+profileSuffix)
+	if err := os.MkdirAll(filepath.Join(stuck, "contents"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := rotateProfiles(c.Dir, 0); err == nil {
+		t.Fatal("expected error removing profile")
+	}
+}
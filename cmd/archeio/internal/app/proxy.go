@@ -0,0 +1,181 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// blobProxy is used to serve blob content through archeio instead of
+// redirecting the client to the backend
+type blobProxy interface {
+	// ProxyBlob should stream blobURL to w
+	//
+	// If an error is returned nothing has been written to w yet, and the
+	// caller may still serve a different response, e.g. a redirect.
+	ProxyBlob(w http.ResponseWriter, r *http.Request, blobURL string) error
+}
+
+// proxiedHeaders are the backend response headers we pass on to clients
+var proxiedHeaders = []string{
+	"Content-Type",
+	"Content-Length",
+	"Content-Range",
+}
+
+// compressedMediaTypes are blob media types that are not worth compressing
+var compressedMediaTypes = map[string]bool{
+	"application/gzip":   true,
+	"application/x-gzip": true,
+	"application/zstd":   true,
+}
+
+// compressedMagic are the leading bytes of content that is not worth
+// compressing, as buckets often serve blobs with a generic Content-Type
+var compressedMagic = [][]byte{
+	// gzip
+	{0x1f, 0x8b},
+	// zstd
+	{0x28, 0xb5, 0x2f, 0xfd},
+}
+
+// httpBlobProxy streams blobs from the backend over HTTP
+type httpBlobProxy struct {
+	client *http.Client
+	// gzip enables compressing responses for clients that accept it
+	gzip bool
+}
+
+func newHTTPBlobProxy(enableGzip bool) *httpBlobProxy {
+	// NOTE: we cannot set an overall client timeout, layers may be large
+	// and slow to stream, instead we bound connecting and waiting for the
+	// backend to respond and otherwise rely on the client request context
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = 5 * time.Second
+	transport.ResponseHeaderTimeout = 10 * time.Second
+	return &httpBlobProxy{
+		client: &http.Client{
+			Transport: transport,
+		},
+		gzip: enableGzip,
+	}
+}
+
+func (p *httpBlobProxy) ProxyBlob(w http.ResponseWriter, r *http.Request, blobURL string) error {
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, blobURL, nil)
+	if err != nil {
+		return err
+	}
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+		req.Header.Set("Range", rangeHeader)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("unexpected status proxying blob: %d", resp.StatusCode)
+	}
+	for _, header := range proxiedHeaders {
+		if value := resp.Header.Get(header); value != "" {
+			w.Header().Set(header, value)
+		}
+	}
+	// we forward Range requests to the backend, which supports them
+	w.Header().Set("Accept-Ranges", "bytes")
+	content := bufio.NewReader(resp.Body)
+	var body io.Writer = w
+	if p.shouldGzip(r, resp, content) {
+		// the compressed length is not known up front
+		w.Header().Del("Content-Length")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Add("Vary", "Accept-Encoding")
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		body = gz
+	}
+	w.WriteHeader(resp.StatusCode)
+	// we've already started the response, so all we can do is log failures
+	if _, err := io.Copy(body, content); err != nil {
+		klog.V(2).InfoS("failed to finish proxying blob", "url", blobURL, "err", err)
+	}
+	return nil
+}
+
+// shouldGzip returns true if we should compress proxying resp to the client
+//
+// We only compress complete blobs, and not those already compressed, going by
+// either the Content-Type or the leading bytes of content.
+func (p *httpBlobProxy) shouldGzip(r *http.Request, resp *http.Response, content *bufio.Reader) bool {
+	if !p.gzip || r.Method != http.MethodGet || resp.StatusCode != http.StatusOK {
+		return false
+	}
+	if resp.Header.Get("Content-Encoding") != "" || !acceptsGzip(r) {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if compressedMediaTypes[mediaType] ||
+		strings.HasSuffix(mediaType, "+gzip") ||
+		strings.HasSuffix(mediaType, "+zstd") {
+		return false
+	}
+	// a short or failed read just leaves less to match, the error will
+	// surface again when copying the content
+	leading, _ := content.Peek(4)
+	for _, magic := range compressedMagic {
+		if bytes.HasPrefix(leading, magic) {
+			return false
+		}
+	}
+	return true
+}
+
+// acceptsGzip returns true if the client's Accept-Encoding allows gzip
+func acceptsGzip(r *http.Request) bool {
+	for _, header := range r.Header.Values("Accept-Encoding") {
+		for _, encoding := range strings.Split(header, ",") {
+			name, params, _ := strings.Cut(encoding, ";")
+			if strings.TrimSpace(name) != "gzip" {
+				continue
+			}
+			// an explicit zero quality value means gzip is not acceptable
+			if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				weight, err := strconv.ParseFloat(q, 64)
+				return err == nil && weight > 0
+			}
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,317 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const fakeBlobContents = "not really a layer, but small enough to test with"
+
+// fakeZstdContents starts with the zstd magic number
+const fakeZstdContents = "\x28\xb5\x2f\xfd" + fakeBlobContents
+
+// gzipContents returns contents compressed with gzip
+func gzipContents(t *testing.T, contents string) string {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(gz, contents); err != nil {
+		t.Fatalf("unexpected error writing gzip: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("unexpected error writing gzip: %v", err)
+	}
+	return buf.String()
+}
+
+// newFakeBlobBackend returns a backend serving fakeBlobContents at /blob
+func newFakeBlobBackend(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/blob", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(fakeBlobContents))
+	})
+	mux.HandleFunc("/layer", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.oci.image.layer.v1.tar+gzip")
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(fakeBlobContents))
+	})
+	// compressed layers, served with the generic type buckets default to
+	gzipped := gzipContents(t, fakeBlobContents)
+	mux.HandleFunc("/gzipped", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "binary/octet-stream")
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(gzipped))
+	})
+	mux.HandleFunc("/zstd", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "binary/octet-stream")
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(fakeZstdContents))
+	})
+	// claims more content than it sends, to simulate a broken connection
+	mux.HandleFunc("/truncated", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Length", "1000")
+		_, _ = io.WriteString(w, fakeBlobContents)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHTTPBlobProxy(t *testing.T) {
+	backend := newFakeBlobBackend(t)
+	proxy := newHTTPBlobProxy(false)
+	testCases := []struct {
+		Name                  string
+		Method                string
+		BlobURL               string
+		Range                 string
+		ExpectError           bool
+		ExpectedStatus        int
+		ExpectedBody          string
+		ExpectedContentType   string
+		ExpectedContentLength string
+		ExpectedContentRange  string
+	}{
+		{
+			Name:                  "GET blob",
+			Method:                http.MethodGet,
+			BlobURL:               backend.URL + "/blob",
+			ExpectedStatus:        http.StatusOK,
+			ExpectedBody:          fakeBlobContents,
+			ExpectedContentType:   "application/octet-stream",
+			ExpectedContentLength: strconv.Itoa(len(fakeBlobContents)),
+		},
+		{
+			Name:                  "HEAD blob",
+			Method:                http.MethodHead,
+			BlobURL:               backend.URL + "/blob",
+			ExpectedStatus:        http.StatusOK,
+			ExpectedContentType:   "application/octet-stream",
+			ExpectedContentLength: strconv.Itoa(len(fakeBlobContents)),
+		},
+		{
+			Name:                  "GET blob range",
+			Method:                http.MethodGet,
+			BlobURL:               backend.URL + "/blob",
+			Range:                 "bytes=4-9",
+			ExpectedStatus:        http.StatusPartialContent,
+			ExpectedBody:          fakeBlobContents[4:10],
+			ExpectedContentType:   "application/octet-stream",
+			ExpectedContentLength: "6",
+			ExpectedContentRange:  "bytes 4-9/" + strconv.Itoa(len(fakeBlobContents)),
+		},
+		{
+			Name:                  "GET blob open ended range",
+			Method:                http.MethodGet,
+			BlobURL:               backend.URL + "/blob",
+			Range:                 "bytes=40-",
+			ExpectedStatus:        http.StatusPartialContent,
+			ExpectedBody:          fakeBlobContents[40:],
+			ExpectedContentType:   "application/octet-stream",
+			ExpectedContentLength: strconv.Itoa(len(fakeBlobContents) - 40),
+			ExpectedContentRange:  "bytes 40-" + strconv.Itoa(len(fakeBlobContents)-1) + "/" + strconv.Itoa(len(fakeBlobContents)),
+		},
+		{
+			Name:                  "GET truncated blob",
+			Method:                http.MethodGet,
+			BlobURL:               backend.URL + "/truncated",
+			ExpectedStatus:        http.StatusOK,
+			ExpectedBody:          fakeBlobContents,
+			ExpectedContentType:   "text/plain; charset=utf-8",
+			ExpectedContentLength: "1000",
+		},
+		{
+			Name:        "missing blob",
+			Method:      http.MethodGet,
+			BlobURL:     backend.URL + "/missing",
+			ExpectError: true,
+		},
+		{
+			Name:        "bogus URL",
+			Method:      http.MethodGet,
+			BlobURL:     "http://\x00",
+			ExpectError: true,
+		},
+		{
+			Name:        "unreachable backend",
+			Method:      http.MethodGet,
+			BlobURL:     "http://127.0.0.1:0/blob",
+			ExpectError: true,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			r := httptest.NewRequest(tc.Method, "http://localhost:8080/v2/pause/blobs/sha256:abc", nil)
+			if tc.Range != "" {
+				r.Header.Set("Range", tc.Range)
+			}
+			recorder := httptest.NewRecorder()
+			err := proxy.ProxyBlob(recorder, r, tc.BlobURL)
+			if tc.ExpectError {
+				if err == nil {
+					t.Fatal("expected error but err was nil")
+				}
+				if recorder.Body.Len() != 0 || len(recorder.Header()) != 0 {
+					t.Fatal("expected nothing to be written on error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			response := recorder.Result()
+			if response.StatusCode != tc.ExpectedStatus {
+				t.Fatalf("expected status: %d, but got status: %d", tc.ExpectedStatus, response.StatusCode)
+			}
+			body, _ := io.ReadAll(response.Body)
+			if !bytes.Equal(body, []byte(tc.ExpectedBody)) {
+				t.Fatalf("expected body: %q, but got: %q", tc.ExpectedBody, body)
+			}
+			if contentType := response.Header.Get("Content-Type"); contentType != tc.ExpectedContentType {
+				t.Fatalf("expected Content-Type: %q, but got: %q", tc.ExpectedContentType, contentType)
+			}
+			if contentLength := response.Header.Get("Content-Length"); contentLength != tc.ExpectedContentLength {
+				t.Fatalf("expected Content-Length: %q, but got: %q", tc.ExpectedContentLength, contentLength)
+			}
+			if contentRange := response.Header.Get("Content-Range"); contentRange != tc.ExpectedContentRange {
+				t.Fatalf("expected Content-Range: %q, but got: %q", tc.ExpectedContentRange, contentRange)
+			}
+			if acceptRanges := response.Header.Get("Accept-Ranges"); acceptRanges != "bytes" {
+				t.Fatalf("expected Accept-Ranges: bytes, but got: %q", acceptRanges)
+			}
+		})
+	}
+}
+
+func TestHTTPBlobProxyGzip(t *testing.T) {
+	backend := newFakeBlobBackend(t)
+	testCases := []struct {
+		Name           string
+		Gzip           bool
+		Path           string
+		AcceptEncoding string
+		Range          string
+		ExpectGzip     bool
+		ExpectedBody   string
+	}{
+		{
+			Name:           "compressible blob",
+			Gzip:           true,
+			Path:           "/blob",
+			AcceptEncoding: "br, gzip;q=0.8",
+			ExpectGzip:     true,
+		},
+		{
+			Name:           "already compressed layer",
+			Gzip:           true,
+			Path:           "/layer",
+			AcceptEncoding: "gzip",
+		},
+		{
+			Name:           "gzip content with generic type",
+			Gzip:           true,
+			Path:           "/gzipped",
+			AcceptEncoding: "gzip",
+			ExpectedBody:   gzipContents(t, fakeBlobContents),
+		},
+		{
+			Name:           "zstd content with generic type",
+			Gzip:           true,
+			Path:           "/zstd",
+			AcceptEncoding: "gzip",
+			ExpectedBody:   fakeZstdContents,
+		},
+		{
+			Name: "client does not accept gzip",
+			Gzip: true,
+			Path: "/blob",
+		},
+		{
+			Name:           "client refuses gzip",
+			Gzip:           true,
+			Path:           "/blob",
+			AcceptEncoding: "gzip;q=0, identity",
+		},
+		{
+			Name:           "range request",
+			Gzip:           true,
+			Path:           "/blob",
+			AcceptEncoding: "gzip",
+			Range:          "bytes=4-9",
+		},
+		{
+			Name:           "disabled",
+			Path:           "/blob",
+			AcceptEncoding: "gzip",
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			proxy := newHTTPBlobProxy(tc.Gzip)
+			r := httptest.NewRequest(http.MethodGet, "http://localhost:8080/v2/pause/blobs/sha256:abc", nil)
+			if tc.AcceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", tc.AcceptEncoding)
+			}
+			if tc.Range != "" {
+				r.Header.Set("Range", tc.Range)
+			}
+			recorder := httptest.NewRecorder()
+			if err := proxy.ProxyBlob(recorder, r, backend.URL+tc.Path); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			response := recorder.Result()
+			encoding := response.Header.Get("Content-Encoding")
+			if !tc.ExpectGzip {
+				if encoding != "" {
+					t.Fatalf("expected no Content-Encoding, but got: %q", encoding)
+				}
+				// passed through unchanged
+				if body := recorder.Body.String(); tc.ExpectedBody != "" && body != tc.ExpectedBody {
+					t.Fatalf("expected body: %q, but got: %q", tc.ExpectedBody, body)
+				}
+				return
+			}
+			if encoding != "gzip" {
+				t.Fatalf("expected Content-Encoding: gzip, but got: %q", encoding)
+			}
+			if contentLength := response.Header.Get("Content-Length"); contentLength != "" {
+				t.Fatalf("expected no Content-Length, but got: %q", contentLength)
+			}
+			gz, err := gzip.NewReader(response.Body)
+			if err != nil {
+				t.Fatalf("unexpected error reading gzip: %v", err)
+			}
+			body, err := io.ReadAll(gz)
+			if err != nil {
+				t.Fatalf("unexpected error reading gzip: %v", err)
+			}
+			if string(body) != fakeBlobContents {
+				t.Fatalf("expected body: %q, but got: %q", fakeBlobContents, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"k8s.io/registry.k8s.io/internal/fakebackend"
+)
+
+// TestMakeHandlerPullFromFakeBackend pulls an image through archeio with
+// both the upstream registry and the bucket served by fakebackend
+func TestMakeHandlerPullFromFakeBackend(t *testing.T) {
+	t.Parallel()
+	backend := fakebackend.New()
+	const upstreamPath = "k8s-artifacts-prod/images"
+	configDigest := backend.PutBlob(upstreamPath+"/pause", []byte(`{"architecture":"amd64","os":"linux"}`))
+	layerDigest := backend.PutBlob(upstreamPath+"/pause", []byte("layer"))
+	// this layer has not been synced to the bucket, so must come from upstream
+	unsyncedDigest := backend.PutBlob(upstreamPath+"/pause", []byte("unsynced layer"))
+	backend.SetStatus("/containers/images/"+unsyncedDigest, http.StatusNotFound)
+	manifest, err := json.Marshal(map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+		"config":        map[string]string{"digest": configDigest},
+		"layers": []map[string]string{
+			{"digest": layerDigest},
+			{"digest": unsyncedDigest},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.PutManifest(upstreamPath+"/pause", "3.9", "application/vnd.oci.image.manifest.v1+json", manifest)
+	backendServer := httptest.NewServer(backend)
+	defer backendServer.Close()
+
+	archeio := httptest.NewServer(MakeHandler(RegistryConfig{
+		UpstreamRegistryEndpoint: backendServer.URL,
+		UpstreamRegistryPath:     upstreamPath,
+		DefaultAWSBaseURL:        backendServer.URL,
+	}))
+	defer archeio.Close()
+	client := archeio.Client()
+	get := func(apiPath string) ([]byte, *http.Response) {
+		t.Helper()
+		resp, err := client.Get(archeio.URL + apiPath)
+		if err != nil {
+			t.Fatalf("failed to get %s: %v", apiPath, err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", apiPath, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status: %d for %s, but got status: %d", http.StatusOK, apiPath, resp.StatusCode)
+		}
+		return body, resp
+	}
+
+	get("/v2/")
+	body, _ := get("/v2/pause/manifests/3.9")
+	var pulled struct {
+		Config struct {
+			Digest string `json:"digest"`
+		} `json:"config"`
+		Layers []struct {
+			Digest string `json:"digest"`
+		} `json:"layers"`
+	}
+	if err := json.Unmarshal(body, &pulled); err != nil {
+		t.Fatalf("failed to parse manifest: %v", err)
+	}
+	expectedSources := map[string]string{
+		configDigest:   "/containers/images/",
+		layerDigest:    "/containers/images/",
+		unsyncedDigest: "/v2/" + upstreamPath + "/pause/blobs/",
+	}
+	digests := []string{pulled.Config.Digest}
+	for _, layer := range pulled.Layers {
+		digests = append(digests, layer.Digest)
+	}
+	for _, digest := range digests {
+		body, resp := get("/v2/pause/blobs/" + digest)
+		if got := fakebackend.Digest(body); got != digest {
+			t.Fatalf("expected blob with digest %s, but got %s", digest, got)
+		}
+		if source := resp.Request.URL.Path; !strings.HasPrefix(source, expectedSources[digest]) {
+			t.Fatalf("expected blob %s to be served from %s, but got %s", digest, expectedSources[digest], source)
+		}
+	}
+}
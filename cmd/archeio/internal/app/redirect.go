@@ -0,0 +1,53 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// defaultRedirectStatus is the status code for registry API redirects,
+// unless overridden for the repository by RedirectStatusOverrides
+const defaultRedirectStatus = http.StatusTemporaryRedirect
+
+// ValidateRedirectStatusOverrides returns an error if overrides contains
+// a status code other than 302 Found or 307 Temporary Redirect
+//
+// Permanent redirects would be cached by clients, so are not allowed.
+func ValidateRedirectStatusOverrides(overrides map[string]int) error {
+	for prefix, status := range overrides {
+		if status != http.StatusFound && status != http.StatusTemporaryRedirect {
+			return fmt.Errorf("invalid redirect status %d for repository prefix %q, expected %d or %d",
+				status, prefix, http.StatusFound, http.StatusTemporaryRedirect)
+		}
+	}
+	return nil
+}
+
+// redirectStatus returns the redirect status code for repository, from the
+// longest prefix in overrides matching whole path components of it
+func redirectStatus(overrides map[string]int, repository string) int {
+	status, matched := defaultRedirectStatus, -1
+	for prefix, override := range overrides {
+		if len(prefix) > matched && (repository == prefix || strings.HasPrefix(repository, prefix+"/")) {
+			status, matched = override, len(prefix)
+		}
+	}
+	return status
+}
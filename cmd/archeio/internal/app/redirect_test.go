@@ -0,0 +1,91 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestValidateRedirectStatusOverrides(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		Name        string
+		Overrides   map[string]int
+		ExpectError bool
+	}{
+		{
+			Name: "none",
+		},
+		{
+			Name:      "302 and 307",
+			Overrides: map[string]int{"legacy": http.StatusFound, "pause": http.StatusTemporaryRedirect},
+		},
+		{
+			Name:        "permanent redirect",
+			Overrides:   map[string]int{"legacy": http.StatusMovedPermanently},
+			ExpectError: true,
+		},
+		{
+			Name:        "not a redirect",
+			Overrides:   map[string]int{"legacy": http.StatusOK},
+			ExpectError: true,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			err := ValidateRedirectStatusOverrides(tc.Overrides)
+			if tc.ExpectError && err == nil {
+				t.Fatal("expected error but got none")
+			} else if !tc.ExpectError && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestRedirectStatus(t *testing.T) {
+	t.Parallel()
+	overrides := map[string]int{
+		"legacy":          http.StatusFound,
+		"legacy/modern":   http.StatusTemporaryRedirect,
+		"sig-storage/nfs": http.StatusFound,
+	}
+	testCases := []struct {
+		Name       string
+		Repository string
+		Expected   int
+	}{
+		{Name: "exact match", Repository: "legacy", Expected: http.StatusFound},
+		{Name: "nested match", Repository: "legacy/pause", Expected: http.StatusFound},
+		{Name: "longest prefix wins", Repository: "legacy/modern/pause", Expected: http.StatusTemporaryRedirect},
+		{Name: "partial component", Repository: "legacy-new", Expected: http.StatusTemporaryRedirect},
+		{Name: "parent of prefix", Repository: "sig-storage", Expected: http.StatusTemporaryRedirect},
+		{Name: "no repository", Repository: "", Expected: http.StatusTemporaryRedirect},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			if status := redirectStatus(overrides, tc.Repository); status != tc.Expected {
+				t.Fatalf("expected status %d, got %d", tc.Expected, status)
+			}
+		})
+	}
+}
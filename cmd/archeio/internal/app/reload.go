@@ -0,0 +1,117 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ReloadableHandler serves requests with a handler that can be replaced
+// without dropping requests, for reloading within one process
+type ReloadableHandler struct {
+	current atomic.Pointer[http.Handler]
+	// serializes Reload, so readiness checks do not race
+	mu sync.Mutex
+}
+
+// NewReloadableHandler returns a ReloadableHandler initially serving h
+func NewReloadableHandler(h http.Handler) *ReloadableHandler {
+	r := &ReloadableHandler{}
+	r.current.Store(&h)
+	return r
+}
+
+// ServeHTTP implements http.Handler with the current handler
+func (h *ReloadableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*h.current.Load()).ServeHTTP(w, r)
+}
+
+// Reload atomically swaps to serving next, but only once ready returns nil
+// for it, otherwise the current handler is kept and the error returned
+//
+// Whichever handler is no longer serving is closed if it is an io.Closer,
+// to stop its background tasks. Requests it is still serving may finish.
+func (h *ReloadableHandler) Reload(next http.Handler, ready func(http.Handler) error) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := ready(next); err != nil {
+		closeHandler(next)
+		return fmt.Errorf("new handler is not ready: %w", err)
+	}
+	closeHandler(*h.current.Swap(&next))
+	return nil
+}
+
+// closeHandler closes h if it is an io.Closer
+func closeHandler(h http.Handler) {
+	if closer, ok := h.(io.Closer); ok {
+		_ = closer.Close()
+	}
+}
+
+// readinessClientIP is a GCP address, so blob requests from it are
+// redirected upstream without probing any backend
+const readinessClientIP = "35.220.26.1"
+
+// readinessCheckKey marks the context of requests made by CheckReady
+type readinessCheckKey struct{}
+
+// newReadinessRequest returns a request for CheckReady, marked so handlers
+// leave it out of routing logs, slow request tracking and metrics
+func newReadinessRequest(target string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	return r.WithContext(context.WithValue(r.Context(), readinessCheckKey{}, true))
+}
+
+// isReadinessCheck returns true if r was made by CheckReady
+func isReadinessCheck(r *http.Request) bool {
+	return r.Context().Value(readinessCheckKey{}) != nil
+}
+
+// CheckReady is a readiness check for handlers from MakeHandler for rc,
+// verifying that h answers the registry API version check and routes a blob
+// request from a GCP client to the upstream registry configured in rc
+func CheckReady(rc RegistryConfig, h http.Handler) error {
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, newReadinessRequest("/v2/"))
+	if recorder.Code != http.StatusOK {
+		return fmt.Errorf("unexpected status for /v2/: %d", recorder.Code)
+	}
+	// a blob in the first allowed digest algorithm
+	algorithm := "sha256"
+	if len(rc.AllowedDigestAlgorithms) > 0 {
+		algorithm = rc.AllowedDigestAlgorithms[0]
+	}
+	blobPath := "/v2/pause/blobs/" + algorithm + ":" + strings.Repeat("0", 64)
+	r := newReadinessRequest(blobPath)
+	// as forwarded by the load balancer
+	r.Header.Set("X-Forwarded-For", readinessClientIP+",130.211.0.1")
+	recorder = httptest.NewRecorder()
+	h.ServeHTTP(recorder, r)
+	expected := upstreamRedirectURL(rc, blobPath)
+	if location := recorder.Header().Get("Location"); location != expected {
+		return fmt.Errorf("unexpected redirect for %s: %d %q, expected %q", blobPath, recorder.Code, location, expected)
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// statusHandler serves every request with a fixed status
+func statusHandler(status int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(status)
+	})
+}
+
+// servedStatus returns the status h serves for a request to path
+func servedStatus(h http.Handler, path string) int {
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest("GET", "http://localhost:8080"+path, nil))
+	return recorder.Code
+}
+
+func TestReloadableHandler(t *testing.T) {
+	h := NewReloadableHandler(statusHandler(http.StatusOK))
+	if status := servedStatus(h, "/"); status != http.StatusOK {
+		t.Fatalf("expected initial handler to serve %d, got: %d", http.StatusOK, status)
+	}
+
+	// not ready, so we must keep serving with the current handler
+	readinessChecked := false
+	err := h.Reload(statusHandler(http.StatusTeapot), func(next http.Handler) error {
+		readinessChecked = true
+		// nothing should be swapped while we're checking
+		if status := servedStatus(h, "/"); status != http.StatusOK {
+			t.Errorf("expected current handler during readiness check, got: %d", status)
+		}
+		return errors.New("not ready")
+	})
+	if err == nil || !readinessChecked {
+		t.Fatal("expected reload to fail readiness")
+	}
+	if status := servedStatus(h, "/"); status != http.StatusOK {
+		t.Fatalf("expected current handler to be kept, got: %d", status)
+	}
+
+	// ready, so we swap
+	if err := h.Reload(statusHandler(http.StatusAccepted), func(http.Handler) error { return nil }); err != nil {
+		t.Fatalf("unexpected error reloading: %v", err)
+	}
+	if status := servedStatus(h, "/"); status != http.StatusAccepted {
+		t.Fatalf("expected new handler to serve %d, got: %d", http.StatusAccepted, status)
+	}
+}
+
+func TestCheckReady(t *testing.T) {
+	registryConfig := RegistryConfig{
+		UpstreamRegistryEndpoint: "https://k8s.gcr.io",
+		UpstreamRegistryPath:     "k8s-artifacts-prod/images",
+	}
+	sha512Config := registryConfig
+	sha512Config.AllowedDigestAlgorithms = []string{"sha512"}
+	testCases := []struct {
+		Name        string
+		Config      RegistryConfig
+		Handler     http.Handler
+		ExpectError bool
+	}{
+		{
+			Name:    "archeio handler",
+			Config:  registryConfig,
+			Handler: MakeHandler(registryConfig),
+		},
+		{
+			Name:    "archeio handler serving other digest algorithms",
+			Config:  sha512Config,
+			Handler: MakeHandler(sha512Config),
+		},
+		{
+			Name:        "failing handler",
+			Config:      registryConfig,
+			Handler:     statusHandler(http.StatusInternalServerError),
+			ExpectError: true,
+		},
+		{
+			Name:        "API check only",
+			Config:      registryConfig,
+			Handler:     statusHandler(http.StatusOK),
+			ExpectError: true,
+		},
+		{
+			Name:   "handler for a different upstream",
+			Config: registryConfig,
+			Handler: MakeHandler(RegistryConfig{
+				UpstreamRegistryEndpoint: "https://registry.example.com",
+			}),
+			ExpectError: true,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			err := CheckReady(tc.Config, tc.Handler)
+			if tc.ExpectError && err == nil {
+				t.Fatal("expected error but got none")
+			} else if !tc.ExpectError && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+// closeRecorder is a handler recording if it has been closed
+type closeRecorder struct {
+	http.Handler
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+// not parallel, checks global metrics
+func TestCheckReadyNotInstrumented(t *testing.T) {
+	registryConfig := RegistryConfig{
+		UpstreamRegistryEndpoint:     "https://k8s.gcr.io",
+		RepeatedBlobRequestThreshold: 1,
+	}
+	slowest := newSlowRequests(10, time.Hour)
+	buf := &bytes.Buffer{}
+	handler := makeV2Handler(context.Background(), registryConfig, &fakeBlobsChecker{}, &fakeBlobProxy{}, slowest, newRoutingLogger(buf), nil)
+	repeatsBefore := testutil.ToFloat64(redirectIgnoredTotal)
+	if err := CheckReady(registryConfig, http.HandlerFunc(handler)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if logged := buf.String(); logged != "" {
+		t.Fatalf("expected readiness checks not to be logged, got: %q", logged)
+	}
+	if recorded := slowest.Snapshot(); len(recorded) != 0 {
+		t.Fatalf("expected readiness checks not to be recorded, got: %v", recorded)
+	}
+	if repeats := testutil.ToFloat64(redirectIgnoredTotal) - repeatsBefore; repeats != 0 {
+		t.Fatalf("expected readiness checks not to be counted as repeats, got: %v", repeats)
+	}
+	// while other requests still are
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v2/", nil))
+	if buf.Len() == 0 || len(slowest.Snapshot()) != 1 {
+		t.Fatal("expected other requests to be logged and recorded")
+	}
+}
+
+func TestReloadableHandlerCloses(t *testing.T) {
+	initial := &closeRecorder{Handler: statusHandler(http.StatusOK)}
+	h := NewReloadableHandler(initial)
+	// a handler failing readiness is closed, as it will never serve
+	rejected := &closeRecorder{Handler: statusHandler(http.StatusTeapot)}
+	if err := h.Reload(rejected, func(http.Handler) error { return errors.New("not ready") }); err == nil {
+		t.Fatal("expected reload to fail readiness")
+	}
+	if !rejected.closed || initial.closed {
+		t.Fatalf("expected only the rejected handler to be closed, got rejected: %t, initial: %t", rejected.closed, initial.closed)
+	}
+	// a replaced handler is closed
+	if err := h.Reload(statusHandler(http.StatusAccepted), func(http.Handler) error { return nil }); err != nil {
+		t.Fatalf("unexpected error reloading: %v", err)
+	}
+	if !initial.closed {
+		t.Fatal("expected replaced handler to be closed")
+	}
+	// handlers without Close are fine too
+	if err := h.Reload(statusHandler(http.StatusOK), func(http.Handler) error { return nil }); err != nil {
+		t.Fatalf("unexpected error reloading: %v", err)
+	}
+}
+
+func TestMakeHandlerClose(t *testing.T) {
+	h := MakeHandler(RegistryConfig{UpstreamRegistryEndpoint: "https://k8s.gcr.io"})
+	closer, ok := h.(io.Closer)
+	if !ok {
+		t.Fatal("expected archeio handler to be an io.Closer")
+	}
+	if err := closer.Close(); err != nil {
+		t.Fatalf("unexpected error closing: %v", err)
+	}
+	// requests in flight may still complete
+	if status := servedStatus(h, "/v2/"); status != http.StatusOK {
+		t.Fatalf("expected closed handler to still serve, got: %d", status)
+	}
+}
+
+func TestReloadableHandlerCheckReady(t *testing.T) {
+	registryConfig := RegistryConfig{UpstreamRegistryEndpoint: "https://k8s.gcr.io"}
+	checkReady := func(h http.Handler) error {
+		return CheckReady(registryConfig, h)
+	}
+	h := NewReloadableHandler(MakeHandler(registryConfig))
+	if err := h.Reload(statusHandler(http.StatusServiceUnavailable), checkReady); err == nil {
+		t.Fatal("expected broken handler to fail readiness")
+	}
+	if err := h.Reload(MakeHandler(registryConfig), checkReady); err != nil {
+		t.Fatalf("expected new archeio handler to pass readiness, got: %v", err)
+	}
+	if status := servedStatus(h, "/v2/"); status != http.StatusOK {
+		t.Fatalf("expected archeio handler to still be serving, got: %d", status)
+	}
+}
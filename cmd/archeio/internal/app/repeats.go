@@ -0,0 +1,100 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+)
+
+type repeatKey struct {
+	clientIP netip.Addr
+	digest   string
+}
+
+type repeatEntry struct {
+	first time.Time
+	count int
+}
+
+// repeatDetector detects clients repeatedly requesting the same blob,
+// which usually means they are not following our redirects
+//
+// It tracks at most maxEntries clients, once full new clients are ignored
+// until tracked clients age out of the window.
+// A nil *repeatDetector is valid and never detects anything.
+type repeatDetector struct {
+	threshold  int
+	window     time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	entries map[repeatKey]*repeatEntry
+}
+
+// newRepeatDetector returns a repeatDetector or nil if threshold is 0
+func newRepeatDetector(threshold int, window time.Duration, maxEntries int) *repeatDetector {
+	if threshold <= 0 {
+		return nil
+	}
+	return &repeatDetector{
+		threshold:  threshold,
+		window:     window,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    map[repeatKey]*repeatEntry{},
+	}
+}
+
+// Observe records a request for digest from clientIP, and returns true if
+// this request reached threshold requests within the window
+func (d *repeatDetector) Observe(clientIP netip.Addr, digest string) bool {
+	if d == nil {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	key := repeatKey{clientIP: clientIP, digest: digest}
+	entry, tracked := d.entries[key]
+	if tracked && now.Sub(entry.first) > d.window {
+		delete(d.entries, key)
+		tracked = false
+	}
+	if !tracked {
+		if len(d.entries) >= d.maxEntries {
+			d.expireLocked(now)
+			if len(d.entries) >= d.maxEntries {
+				return false
+			}
+		}
+		entry = &repeatEntry{first: now}
+		d.entries[key] = entry
+	}
+	entry.count++
+	return entry.count == d.threshold
+}
+
+func (d *repeatDetector) expireLocked(now time.Time) {
+	for key, entry := range d.entries {
+		if now.Sub(entry.first) > d.window {
+			delete(d.entries, key)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRepeatDetector(t *testing.T) {
+	d := newRepeatDetector(3, time.Minute, 2)
+	now := time.Now()
+	d.now = func() time.Time { return now }
+	clientA := netip.MustParseAddr("192.0.2.1")
+	clientB := netip.MustParseAddr("192.0.2.2")
+	clientC := netip.MustParseAddr("192.0.2.3")
+
+	// trips exactly once when reaching the threshold
+	for i, expected := range []bool{false, false, true, false} {
+		if tripped := d.Observe(clientA, "sha256:a"); tripped != expected {
+			t.Fatalf("request %d: expected tripped: %t, but got: %t", i, expected, tripped)
+		}
+	}
+	// other digests and clients are counted separately
+	if d.Observe(clientA, "sha256:b") {
+		t.Fatal("expected different digest not to trip")
+	}
+	// but we're full now, so new clients are not tracked
+	for i := 0; i < 3; i++ {
+		if d.Observe(clientC, "sha256:a") {
+			t.Fatal("expected untracked client not to trip")
+		}
+	}
+
+	// after the window, old requests are forgotten and room is made
+	now = now.Add(2 * time.Minute)
+	for i, expected := range []bool{false, false, true} {
+		if tripped := d.Observe(clientA, "sha256:a"); tripped != expected {
+			t.Fatalf("request %d after window: expected tripped: %t, but got: %t", i, expected, tripped)
+		}
+	}
+	for i, expected := range []bool{false, false, true} {
+		if tripped := d.Observe(clientB, "sha256:a"); tripped != expected {
+			t.Fatalf("request %d for new client: expected tripped: %t, but got: %t", i, expected, tripped)
+		}
+	}
+}
+
+func TestRepeatDetectorDisabled(t *testing.T) {
+	d := newRepeatDetector(0, time.Minute, 10)
+	for i := 0; i < 10; i++ {
+		if d.Observe(netip.MustParseAddr("192.0.2.1"), "sha256:a") {
+			t.Fatal("expected disabled detector never to trip")
+		}
+	}
+}
+
+func TestMakeV2HandlerRepeatedBlobRequests(t *testing.T) {
+	registryConfig := RegistryConfig{
+		UpstreamRegistryEndpoint:     "https://k8s.gcr.io",
+		RepeatedBlobRequestThreshold: 3,
+	}
+	handler := makeV2Handler(context.Background(), registryConfig, &fakeBlobsChecker{}, &fakeBlobProxy{}, nil, nil, nil)
+	before := testutil.ToFloat64(redirectIgnoredTotal)
+	for i := 0; i < 5; i++ {
+		r := httptest.NewRequest("GET", "http://localhost:8080/v2/pause/blobs/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e", nil)
+		r.RemoteAddr = "192.0.2.10:888"
+		recorder := httptest.NewRecorder()
+		handler(recorder, r)
+		// we should still serve them normally
+		if recorder.Code != http.StatusTemporaryRedirect {
+			t.Fatalf("expected status: %d, but got status: %d", http.StatusTemporaryRedirect, recorder.Code)
+		}
+	}
+	if detected := testutil.ToFloat64(redirectIgnoredTotal) - before; detected != 1 {
+		t.Fatalf("expected client to be detected once, got: %v", detected)
+	}
+}
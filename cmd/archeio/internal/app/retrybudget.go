@@ -0,0 +1,65 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import "sync"
+
+// retryBudget limits fallback probes to a fraction of blob lookups, like
+// gRPC retry throttling, so that when a primary bucket fails for many
+// clients at once the fallback buckets don't get a thundering herd
+//
+// Every lookup deposits ratio tokens up to maxTokens, every fallback probe
+// withdraws one. A nil *retryBudget allows every fallback probe.
+type retryBudget struct {
+	ratio     float64
+	maxTokens float64
+
+	mu     sync.Mutex
+	tokens float64
+}
+
+func newRetryBudget(ratio, maxTokens float64) *retryBudget {
+	return &retryBudget{
+		ratio:     ratio,
+		maxTokens: maxTokens,
+		tokens:    maxTokens,
+	}
+}
+
+// Deposit records a blob lookup
+func (b *retryBudget) Deposit() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.maxTokens, b.tokens+b.ratio)
+}
+
+// Withdraw returns true if a fallback probe is within the budget
+func (b *retryBudget) Withdraw() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRetryBudget(t *testing.T) {
+	t.Parallel()
+	var nilBudget *retryBudget
+	nilBudget.Deposit()
+	if !nilBudget.Withdraw() {
+		t.Fatal("expected nil budget to allow everything")
+	}
+	b := newRetryBudget(0.5, 2)
+	// starts full
+	for i := 0; i < 2; i++ {
+		if !b.Withdraw() {
+			t.Fatalf("expected withdrawal %d from the initial budget to succeed", i)
+		}
+	}
+	if b.Withdraw() {
+		t.Fatal("expected withdrawal from an empty budget to fail")
+	}
+	// two lookups earn one fallback
+	b.Deposit()
+	if b.Withdraw() {
+		t.Fatal("expected withdrawal of half a token to fail")
+	}
+	b.Deposit()
+	if !b.Withdraw() {
+		t.Fatal("expected withdrawal after two deposits to succeed")
+	}
+	// deposits are capped
+	for i := 0; i < 10; i++ {
+		b.Deposit()
+	}
+	for i := 0; i < 2; i++ {
+		if !b.Withdraw() {
+			t.Fatalf("expected withdrawal %d from the capped budget to succeed", i)
+		}
+	}
+	if b.Withdraw() {
+		t.Fatal("expected deposits to be capped")
+	}
+}
+
+// countingBlobsChecker counts probes by URL
+type countingBlobsChecker struct {
+	knownURLs map[string]bool
+
+	mu     sync.Mutex
+	probes map[string]int
+}
+
+func (c *countingBlobsChecker) BlobExists(_ context.Context, blobURL string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.probes[blobURL]++
+	return c.knownURLs[blobURL], nil
+}
+
+// not parallel, checks global metrics
+func TestMakeV2HandlerFallbackProbeRatio(t *testing.T) {
+	const blobPath = "/v2/pause/blobs/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	const euWest1BlobURL = "https://prod-registry-k8s-io-eu-west-1.s3.dualstack.eu-west-1.amazonaws.com/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	const h2BlobURL = "https://h2.example.com/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	const requests, ratio = 200, 0.1
+	for _, disableUpstream := range []bool{false, true} {
+		t.Run(fmt.Sprintf("DisableUpstreamBlobFallback=%t", disableUpstream), func(t *testing.T) {
+			// the preferred backend is failing for everyone, so every lookup
+			// would fall back to the regional bucket
+			blobs := &countingBlobsChecker{
+				knownURLs: map[string]bool{euWest1BlobURL: true},
+				probes:    map[string]int{},
+			}
+			registryConfig := RegistryConfig{
+				UpstreamRegistryEndpoint:    "https://k8s.gcr.io",
+				ProtocolBackends:            map[string]string{"h2": "https://h2.example.com"},
+				FallbackProbeRatio:          ratio,
+				DisableUpstreamBlobFallback: disableUpstream,
+			}
+			handler := makeV2Handler(context.Background(), registryConfig, blobs, &fakeBlobProxy{}, nil, nil, nil)
+			skippedBefore := testutil.ToFloat64(fallbackProbesSkippedTotal)
+			for i := 0; i < requests; i++ {
+				r := httptest.NewRequest("GET", "http://localhost:8080"+blobPath, nil)
+				r.RemoteAddr = "52.208.1.1:888"
+				r.TLS = &tls.ConnectionState{NegotiatedProtocol: "h2"}
+				recorder := httptest.NewRecorder()
+				handler(recorder, r)
+				response := recorder.Result()
+				if response.StatusCode != http.StatusTemporaryRedirect {
+					t.Fatalf("expected status: %d, but got status: %d", http.StatusTemporaryRedirect, response.StatusCode)
+				}
+				// skipped lookups are still sent to the usual bucket
+				if location := response.Header.Get("Location"); location != euWest1BlobURL {
+					t.Fatalf("expected url: %q, but got: %q", euWest1BlobURL, location)
+				}
+			}
+			if probes := blobs.probes[h2BlobURL]; probes != requests {
+				t.Fatalf("expected every lookup to probe the primary, got %d probes", probes)
+			}
+			fallbackProbes := blobs.probes[euWest1BlobURL]
+			if limit := fallbackProbeBurst + int(requests*ratio); fallbackProbes > limit || fallbackProbes < limit-1 {
+				t.Fatalf("expected about %d fallback probes, got %d", limit, fallbackProbes)
+			}
+			if skipped := testutil.ToFloat64(fallbackProbesSkippedTotal) - skippedBefore; int(skipped) != requests-fallbackProbes {
+				t.Fatalf("expected %d skipped fallback probes, got %v", requests-fallbackProbes, skipped)
+			}
+		})
+	}
+}
+
+func TestMakeV2HandlerFallbackProbeRatioUsualBucketMissing(t *testing.T) {
+	t.Parallel()
+	const blobPath = "/v2/pause/blobs/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	const upstreamURL = "https://k8s.gcr.io/v2/pause/blobs/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	// no bucket has the blob, and the usual bucket is always checked first
+	blobs := &countingBlobsChecker{probes: map[string]int{}}
+	registryConfig := RegistryConfig{
+		UpstreamRegistryEndpoint:    "https://k8s.gcr.io",
+		CostAwareRouting:            true,
+		FallbackProbeRatio:          0.01,
+		DisableUpstreamBlobFallback: true,
+	}
+	handler := makeV2Handler(context.Background(), registryConfig, blobs, &fakeBlobProxy{}, nil, nil, nil)
+	var notFound, upstream int
+	for i := 0; i < 20; i++ {
+		r := httptest.NewRequest("GET", "http://localhost:8080"+blobPath, nil)
+		r.RemoteAddr = "52.208.1.1:888"
+		recorder := httptest.NewRecorder()
+		handler(recorder, r)
+		response := recorder.Result()
+		switch {
+		case response.StatusCode == http.StatusNotFound:
+			notFound++
+		case response.StatusCode == http.StatusTemporaryRedirect && response.Header.Get("Location") == upstreamURL:
+			upstream++
+		default:
+			t.Fatalf("unexpected response: %d %q", response.StatusCode, response.Header.Get("Location"))
+		}
+	}
+	// lookups that checked every candidate confirm the blob is missing,
+	// once the budget runs out the rest cannot, so go upstream instead
+	if notFound == 0 || upstream == 0 {
+		t.Fatalf("expected both missing and upstream responses, got %d and %d", notFound, upstream)
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// Routing log formats for RegistryConfig.RoutingLogFormat
+const (
+	// RoutingLogFormatV1 emits routingRecord as JSON lines
+	RoutingLogFormatV1 = "v1"
+)
+
+// routingLogSchemaVersion is the version of the routingRecord field set
+//
+// This must be incremented whenever fields are added, removed or change
+// meaning, and docs/request-handling.md updated to match.
+const routingLogSchemaVersion = 1
+
+// Routing decisions recorded in routingRecord.Decision
+const (
+	decisionAPICheck         = "api_check"
+	decisionRejected         = "rejected"
+	decisionNotFound         = "not_found"
+	decisionUnavailable      = "unavailable"
+	decisionRedirectUpstream = "redirect_upstream"
+	decisionRedirectAWS      = "redirect_aws"
+	decisionProxyAWS         = "proxy_aws"
+)
+
+// routingRecord is a flat, versioned record of how a request was routed,
+// suitable for loading into a database
+//
+// Every field is always present, so the schema does not depend on the request.
+type routingRecord struct {
+	SchemaVersion int     `json:"schema_version"`
+	Timestamp     string  `json:"timestamp"`
+	Method        string  `json:"method"`
+	Path          string  `json:"path"`
+	ClientCloud   string  `json:"client_cloud"`
+	ClientRegion  string  `json:"client_region"`
+	Decision      string  `json:"decision"`
+	Backend       string  `json:"backend"`
+	DurationMS    float64 `json:"duration_ms"`
+}
+
+// routingLogger writes routingRecords as JSON lines
+//
+// A nil *routingLogger is valid and logs nothing.
+type routingLogger struct {
+	now func() time.Time
+
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// routingLogOutput returns where rc logs routing decisions
+func routingLogOutput(rc RegistryConfig) io.Writer {
+	if rc.RoutingLogOutput == nil {
+		return os.Stdout
+	}
+	return rc.RoutingLogOutput
+}
+
+func newRoutingLogger(w io.Writer) *routingLogger {
+	return &routingLogger{
+		now: time.Now,
+		enc: json.NewEncoder(w),
+	}
+}
+
+// Log writes record, filling in the schema version and timestamp
+func (l *routingLogger) Log(record routingRecord) {
+	if l == nil {
+		return
+	}
+	record.SchemaVersion = routingLogSchemaVersion
+	record.Timestamp = l.now().UTC().Format(time.RFC3339Nano)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.enc.Encode(record); err != nil {
+		klog.ErrorS(err, "failed to write routing log")
+	}
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// expectedRoutingLogFields is the documented field set for schema version 1
+var expectedRoutingLogFields = []string{
+	"backend",
+	"client_cloud",
+	"client_region",
+	"decision",
+	"duration_ms",
+	"method",
+	"path",
+	"schema_version",
+	"timestamp",
+}
+
+// decodeRoutingLog decodes the JSON lines written by a routingLogger
+func decodeRoutingLog(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		record := map[string]any{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("failed to decode routing log line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestRoutingLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := newRoutingLogger(buf)
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.FixedZone("test", 3600))
+	l.now = func() time.Time { return now }
+	// even empty records should have every field
+	l.Log(routingRecord{})
+	l.Log(routingRecord{Method: "GET", Path: "/v2/", Decision: decisionAPICheck, DurationMS: 1.5})
+
+	records := decodeRoutingLog(t, buf)
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got: %v", records)
+	}
+	for _, record := range records {
+		fields := make([]string, 0, len(record))
+		for field := range record {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		if !reflect.DeepEqual(fields, expectedRoutingLogFields) {
+			t.Fatalf("expected fields: %v, but got: %v", expectedRoutingLogFields, fields)
+		}
+		if record["schema_version"] != float64(routingLogSchemaVersion) || routingLogSchemaVersion != 1 {
+			t.Fatalf("expected schema version 1, got: %v", record["schema_version"])
+		}
+		if record["timestamp"] != "2026-01-02T02:04:05Z" {
+			t.Fatalf("expected UTC timestamp, got: %v", record["timestamp"])
+		}
+	}
+	if records[1]["decision"] != decisionAPICheck || records[1]["duration_ms"] != 1.5 {
+		t.Fatalf("unexpected record: %v", records[1])
+	}
+}
+
+func TestRoutingLoggerNil(t *testing.T) {
+	var l *routingLogger
+	// should not panic
+	l.Log(routingRecord{})
+}
+
+// failingWriter fails all writes
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestRoutingLoggerWriteError(t *testing.T) {
+	// errors are logged, not fatal
+	newRoutingLogger(failingWriter{}).Log(routingRecord{})
+}
+
+func TestMakeV2HandlerRoutingLog(t *testing.T) {
+	registryConfig := RegistryConfig{
+		UpstreamRegistryEndpoint:    "https://k8s.gcr.io",
+		DisableUpstreamBlobFallback: true,
+	}
+	const digest = "sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	bucketURL := awsRegionToHostURL("eu-west-3", "")
+	blobs := &fakeBlobsChecker{knownURLs: map[string]bool{
+		bucketBlobURL(registryConfig, bucketURL, digest): true,
+	}}
+	buf := &bytes.Buffer{}
+	handler := makeV2Handler(context.Background(), registryConfig, blobs, &fakeBlobProxy{}, nil, newRoutingLogger(buf), nil)
+	requests := []struct {
+		Path       string
+		RemoteAddr string
+	}{
+		{Path: "/v2/", RemoteAddr: "192.0.2.1:888"},
+		{Path: "/v2/pause/manifests/latest", RemoteAddr: "192.0.2.1:888"},
+		{Path: "/v2/pause/blobs/" + digest, RemoteAddr: "35.180.1.1:888"},
+		{Path: "/v2/pause/blobs/" + digest, RemoteAddr: "35.220.26.1:888"},
+		{Path: "/v2/pause/blobs/sha256:ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", RemoteAddr: "35.180.1.1:888"},
+		{Path: "/v2/pause/blobs/md5:d41d8cd98f00b204e9800998ecf8427e", RemoteAddr: "35.180.1.1:888"},
+	}
+	for _, request := range requests {
+		r := httptest.NewRequest("GET", "http://localhost:8080"+request.Path, nil)
+		r.RemoteAddr = request.RemoteAddr
+		handler(httptest.NewRecorder(), r)
+	}
+	type routed struct {
+		Cloud, Region, Decision, Backend string
+	}
+	expected := []routed{
+		{Decision: decisionAPICheck},
+		{Decision: decisionRedirectUpstream, Backend: registryConfig.UpstreamRegistryEndpoint},
+		{Cloud: "AWS", Region: "eu-west-3", Decision: decisionRedirectAWS, Backend: bucketURL},
+		{Cloud: "GCP", Region: "europe-north1", Decision: decisionRedirectUpstream, Backend: registryConfig.UpstreamRegistryEndpoint},
+		{Cloud: "AWS", Region: "eu-west-3", Decision: decisionNotFound},
+		{Decision: decisionRejected},
+	}
+	records := decodeRoutingLog(t, buf)
+	if len(records) != len(expected) {
+		t.Fatalf("expected %d records, got: %v", len(expected), records)
+	}
+	for i, record := range records {
+		actual := routed{
+			Cloud:    record["client_cloud"].(string),
+			Region:   record["client_region"].(string),
+			Decision: record["decision"].(string),
+			Backend:  record["backend"].(string),
+		}
+		if actual != expected[i] {
+			t.Fatalf("request %d: expected: %+v, but got: %+v", i, expected[i], actual)
+		}
+		if record["method"] != http.MethodGet || record["path"] != requests[i].Path {
+			t.Fatalf("request %d: unexpected record: %v", i, record)
+		}
+	}
+}
+
+func TestRoutingLogOutput(t *testing.T) {
+	t.Parallel()
+	if output := routingLogOutput(RegistryConfig{}); output != os.Stdout {
+		t.Fatalf("expected routing log to default to stdout, got: %v", output)
+	}
+	buf := &bytes.Buffer{}
+	if output := routingLogOutput(RegistryConfig{RoutingLogOutput: buf}); output != buf {
+		t.Fatalf("expected configured routing log output, got: %v", output)
+	}
+}
+
+func TestMakeHandlerRoutingLogFormat(t *testing.T) {
+	t.Parallel()
+	buf := &bytes.Buffer{}
+	handler := MakeHandler(RegistryConfig{
+		RoutingLogFormat: RoutingLogFormatV1,
+		RoutingLogOutput: buf,
+	})
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "http://localhost:8080/v2/", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status: %d, but got status: %d", http.StatusOK, recorder.Code)
+	}
+	records := decodeRoutingLog(t, buf)
+	if len(records) != 1 || records[0]["decision"] != decisionAPICheck {
+		t.Fatalf("expected one %s record, got: %v", decisionAPICheck, records)
+	}
+}
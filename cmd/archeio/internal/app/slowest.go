@@ -0,0 +1,105 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// slowRequest is a request recorded by slowRequests
+type slowRequest struct {
+	Path         string        `json:"path"`
+	ClientRegion string        `json:"clientRegion"`
+	Backend      string        `json:"backend"`
+	Duration     time.Duration `json:"durationNanoseconds"`
+	Time         time.Time     `json:"time"`
+}
+
+// slowRequests tracks the slowest recently served requests for debugging
+//
+// It holds at most limit requests, and forgets requests older than maxAge.
+// A nil *slowRequests or a limit of 0 is valid and records nothing.
+type slowRequests struct {
+	limit  int
+	maxAge time.Duration
+	now    func() time.Time
+
+	mu sync.Mutex
+	// sorted by Duration, slowest first
+	requests []slowRequest
+}
+
+func newSlowRequests(limit int, maxAge time.Duration) *slowRequests {
+	return &slowRequests{
+		limit:  limit,
+		maxAge: maxAge,
+		now:    time.Now,
+	}
+}
+
+// Record records a request if it is among the slowest recent requests
+func (s *slowRequests) Record(path, clientRegion, backend string, duration time.Duration) {
+	if s == nil || s.limit <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.expireLocked(now)
+	// common case, we're full and this request is not slow enough to matter
+	if len(s.requests) == s.limit && duration <= s.requests[len(s.requests)-1].Duration {
+		return
+	}
+	i := sort.Search(len(s.requests), func(i int) bool {
+		return s.requests[i].Duration < duration
+	})
+	s.requests = append(s.requests, slowRequest{})
+	copy(s.requests[i+1:], s.requests[i:])
+	s.requests[i] = slowRequest{
+		Path:         path,
+		ClientRegion: clientRegion,
+		Backend:      backend,
+		Duration:     duration,
+		Time:         now,
+	}
+	if len(s.requests) > s.limit {
+		s.requests = s.requests[:s.limit]
+	}
+}
+
+// Snapshot returns a copy of the recorded requests, slowest first
+func (s *slowRequests) Snapshot() []slowRequest {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expireLocked(s.now())
+	return append([]slowRequest{}, s.requests...)
+}
+
+func (s *slowRequests) expireLocked(now time.Time) {
+	kept := s.requests[:0]
+	for _, request := range s.requests {
+		if now.Sub(request.Time) <= s.maxAge {
+			kept = append(kept, request)
+		}
+	}
+	s.requests = kept
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSlowRequests(t *testing.T) {
+	s := newSlowRequests(3, time.Hour)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	s.Record("/v2/a", "us-east-1", "backend-a", 2*time.Second)
+	s.Record("/v2/b", "us-east-1", "backend-b", 5*time.Second)
+	s.Record("/v2/c", "eu-west-1", "backend-c", 1*time.Second)
+	s.Record("/v2/d", "eu-west-1", "backend-d", 3*time.Second)
+	// too fast to be recorded now that we're full
+	s.Record("/v2/e", "eu-west-1", "backend-e", 1*time.Second)
+	assertSlowRequestPaths(t, s.Snapshot(), "/v2/b", "/v2/d", "/v2/a")
+	if request := s.Snapshot()[0]; request.ClientRegion != "us-east-1" || request.Backend != "backend-b" || !request.Time.Equal(now) {
+		t.Fatalf("unexpected request recorded: %+v", request)
+	}
+
+	// old requests should be forgotten, even if they were slow
+	now = now.Add(30 * time.Minute)
+	s.Record("/v2/f", "eu-west-1", "backend-f", 10*time.Second)
+	assertSlowRequestPaths(t, s.Snapshot(), "/v2/f", "/v2/b", "/v2/d")
+	now = now.Add(45 * time.Minute)
+	assertSlowRequestPaths(t, s.Snapshot(), "/v2/f")
+}
+
+func TestSlowRequestsConcurrent(t *testing.T) {
+	s := newSlowRequests(10, time.Hour)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s.Record("/v2/", "", "", time.Duration(i))
+		}(i)
+	}
+	wg.Wait()
+	snapshot := s.Snapshot()
+	if len(snapshot) != 10 {
+		t.Fatalf("expected 10 requests, got %d", len(snapshot))
+	}
+	for i, request := range snapshot {
+		if expected := time.Duration(99 - i); request.Duration != expected {
+			t.Fatalf("expected request %d to have duration %v, got %v", i, expected, request.Duration)
+		}
+	}
+}
+
+func TestSlowRequestsNil(t *testing.T) {
+	var s *slowRequests
+	s.Record("/v2/", "", "", time.Second)
+	if snapshot := s.Snapshot(); snapshot != nil {
+		t.Fatalf("expected nil snapshot, got: %v", snapshot)
+	}
+}
+
+func assertSlowRequestPaths(t *testing.T, requests []slowRequest, paths ...string) {
+	t.Helper()
+	if len(requests) != len(paths) {
+		t.Fatalf("expected %d requests, got %d: %+v", len(paths), len(requests), requests)
+	}
+	for i := range paths {
+		if requests[i].Path != paths[i] {
+			t.Fatalf("expected request %d to be %q, got %q", i, paths[i], requests[i].Path)
+		}
+	}
+}
+
+func TestSlowRequestsDisabled(t *testing.T) {
+	s := newSlowRequests(0, time.Hour)
+	s.Record("/v2/", "", "", time.Second)
+	if snapshot := s.Snapshot(); len(snapshot) != 0 {
+		t.Fatalf("expected no requests, got: %v", snapshot)
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"k8s.io/klog/v2"
+
+	"k8s.io/registry.k8s.io/pkg/net/cloudcidrs"
+)
+
+// LogStartupSummary logs a one line summary of the effective routing
+// configuration and IP range data, for verifying a deploy at a glance
+func LogStartupSummary(rc RegistryConfig) {
+	logStartupSummary(rc, klog.InfoS)
+}
+
+func logStartupSummary(rc RegistryConfig, infoS func(msg string, keysAndValues ...any)) {
+	infoS("startup summary",
+		"regions", regionCounts(),
+		"prefixes", cloudcidrs.PrefixCounts(),
+		"selfRegion", rc.SelfRegion,
+		"defaultBucket", rc.DefaultAWSBaseURL,
+		"features", enabledFeatures(rc),
+		"dataVersion", cloudcidrs.DataVersion(),
+	)
+}
+
+// enabledFeatures returns the names of optional features enabled in rc
+func enabledFeatures(rc RegistryConfig) []string {
+	features := []struct {
+		name    string
+		enabled bool
+	}{
+		{"proxyBlobs", len(rc.ProxyBlobRegions) > 0},
+		{"proxyBlobGzip", rc.ProxyBlobGzip},
+		{"blobAlternateLinks", rc.BlobAlternateLinks > 0},
+		{"admin", rc.AdminToken != ""},
+		{"blobCacheTTL", rc.BlobCacheTTL > 0},
+		{"serveStaleOnError", rc.ServeStaleOnError},
+		{"disableBlobCache", rc.DisableBlobCache},
+		{"blobCacheMinSize", rc.BlobCacheMinSize > 0},
+		{"verifyBlobETag", rc.VerifyBlobETag},
+		{"forbiddenBlobExists", rc.ForbiddenBlobExists},
+		{"probeRootCAs", rc.ProbeRootCAs != nil},
+		{"backends", len(rc.Backends) > 0},
+		{"repeatedBlobRequests", rc.RepeatedBlobRequestThreshold > 0},
+		{"costAwareRouting", rc.CostAwareRouting},
+		{"fallbackProbeBudget", rc.FallbackProbeRatio > 0},
+		{"disableUpstreamBlobFallback", rc.DisableUpstreamBlobFallback},
+		{"neighborWarming", len(rc.NeighborRegions) > 0},
+		{"egressCostHeaders", rc.EgressCostHeaders},
+		{"protocolBackends", len(rc.ProtocolBackends) > 0},
+		{"errorLogLimit", rc.ErrorLogQPS > 0},
+		{"redirectStatusOverrides", len(rc.RedirectStatusOverrides) > 0},
+		{"maintenanceWarning", rc.MaintenanceWarning != ""},
+		{"routingLog", rc.RoutingLogFormat != ""},
+	}
+	enabled := []string{}
+	for _, feature := range features {
+		if feature.enabled {
+			enabled = append(enabled, feature.name)
+		}
+	}
+	return enabled
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/registry.k8s.io/pkg/net/cloudcidrs"
+)
+
+func TestLogStartupSummary(t *testing.T) {
+	registryConfig := RegistryConfig{
+		SelfRegion:        "us-east-2",
+		DefaultAWSBaseURL: "https://default.example.com",
+		AdminToken:        testAdminToken,
+		CostAwareRouting:  true,
+	}
+	calls := 0
+	fields := map[string]any{}
+	logStartupSummary(registryConfig, func(msg string, keysAndValues ...any) {
+		calls++
+		if msg != "startup summary" {
+			t.Errorf("unexpected message: %q", msg)
+		}
+		for i := 0; i+1 < len(keysAndValues); i += 2 {
+			fields[keysAndValues[i].(string)] = keysAndValues[i+1]
+		}
+	})
+	if calls != 1 {
+		t.Fatalf("expected a single summary line, got: %d", calls)
+	}
+	for _, key := range []string{"regions", "prefixes", "selfRegion", "defaultBucket", "features", "dataVersion"} {
+		if _, ok := fields[key]; !ok {
+			t.Fatalf("expected %q in summary, got: %v", key, fields)
+		}
+	}
+	if regions := fields["regions"].(map[string]int); regions[cloudcidrs.AWS] == 0 || regions[cloudcidrs.GCP] == 0 {
+		t.Fatalf("expected AWS and GCP regions, got: %v", regions)
+	}
+	if prefixes := fields["prefixes"].(map[string]int); prefixes[cloudcidrs.AWS] == 0 || prefixes[cloudcidrs.GCP] == 0 {
+		t.Fatalf("expected AWS and GCP prefixes, got: %v", prefixes)
+	}
+	if fields["selfRegion"] != "us-east-2" || fields["defaultBucket"] != "https://default.example.com" {
+		t.Fatalf("unexpected default routing in summary: %v", fields)
+	}
+	if features := fields["features"].([]string); !reflect.DeepEqual(features, []string{"admin", "costAwareRouting"}) {
+		t.Fatalf("unexpected features: %v", features)
+	}
+	if fields["dataVersion"] != cloudcidrs.DataVersion() {
+		t.Fatalf("unexpected data version: %v", fields["dataVersion"])
+	}
+	// secrets must never be logged
+	for key, value := range fields {
+		if value == testAdminToken {
+			t.Fatalf("expected admin token not to be logged, got it in %q", key)
+		}
+	}
+}
+
+func TestLogStartupSummaryKlog(t *testing.T) {
+	// should not panic
+	LogStartupSummary(RegistryConfig{})
+}
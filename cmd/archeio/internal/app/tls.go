@@ -0,0 +1,89 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSConfig configures TLS for deployments where archeio terminates TLS
+// itself rather than behind a loadbalancer
+type TLSConfig struct {
+	// MinVersion is the minimum TLS version, "1.2" (default) or "1.3"
+	MinVersion string
+	// CipherSuites are the allowed TLS 1.2 cipher suites by name,
+	// e.g. TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256
+	//
+	// Defaults to the Go standard library's secure cipher suites.
+	// TLS 1.3 cipher suites are not configurable.
+	CipherSuites []string
+}
+
+// MakeTLSConfig returns a *tls.Config enforcing c
+func MakeTLSConfig(c TLSConfig) (*tls.Config, error) {
+	config := &tls.Config{}
+	switch c.MinVersion {
+	case "", "1.2":
+		config.MinVersion = tls.VersionTLS12
+	case "1.3":
+		config.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported minimum TLS version: %q", c.MinVersion)
+	}
+	if len(c.CipherSuites) == 0 {
+		return config, nil
+	}
+	// only allow suites go considers secure
+	secureSuites := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		secureSuites[suite.Name] = suite.ID
+	}
+	for _, name := range c.CipherSuites {
+		id, ok := secureSuites[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported or insecure TLS cipher suite: %q", name)
+		}
+		config.CipherSuites = append(config.CipherSuites, id)
+	}
+	return config, nil
+}
+
+// systemCertPool is x509.SystemCertPool, except in tests
+var systemCertPool = x509.SystemCertPool
+
+// LoadCertPool returns the system root CAs plus the PEM encoded certificates
+// in files, for trusting backends using an internal CA
+func LoadCertPool(files []string) (*x509.CertPool, error) {
+	pool, err := systemCertPool()
+	if err != nil {
+		// some platforms have no system pool, we can still use ours
+		pool = x509.NewCertPool()
+	}
+	for _, file := range files {
+		pem, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %q", file)
+		}
+	}
+	return pool, nil
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMakeTLSConfig(t *testing.T) {
+	testCases := []struct {
+		Name                 string
+		Config               TLSConfig
+		ExpectError          bool
+		ExpectedMinVersion   uint16
+		ExpectedCipherSuites []uint16
+	}{
+		{
+			Name:               "defaults",
+			Config:             TLSConfig{},
+			ExpectedMinVersion: tls.VersionTLS12,
+		},
+		{
+			Name:               "TLS 1.3",
+			Config:             TLSConfig{MinVersion: "1.3"},
+			ExpectedMinVersion: tls.VersionTLS13,
+		},
+		{
+			Name:        "TLS 1.1 is too old",
+			Config:      TLSConfig{MinVersion: "1.1"},
+			ExpectError: true,
+		},
+		{
+			Name:        "TLS 1.0 is too old",
+			Config:      TLSConfig{MinVersion: "1.0"},
+			ExpectError: true,
+		},
+		{
+			Name: "cipher suites",
+			Config: TLSConfig{
+				MinVersion:   "1.2",
+				CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"},
+			},
+			ExpectedMinVersion:   tls.VersionTLS12,
+			ExpectedCipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384},
+		},
+		{
+			Name:        "insecure cipher suite",
+			Config:      TLSConfig{CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+			ExpectError: true,
+		},
+		{
+			Name:        "unknown cipher suite",
+			Config:      TLSConfig{CipherSuites: []string{"TLS_BOGUS"}},
+			ExpectError: true,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			config, err := MakeTLSConfig(tc.Config)
+			if err != nil {
+				if !tc.ExpectError {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			} else if tc.ExpectError {
+				t.Fatal("expected error but err was nil")
+			}
+			if config.MinVersion != tc.ExpectedMinVersion {
+				t.Fatalf("expected MinVersion: %x, but got: %x", tc.ExpectedMinVersion, config.MinVersion)
+			}
+			if !reflect.DeepEqual(config.CipherSuites, tc.ExpectedCipherSuites) {
+				t.Fatalf("expected CipherSuites: %v, but got: %v", tc.ExpectedCipherSuites, config.CipherSuites)
+			}
+		})
+	}
+}
+
+func TestMakeTLSConfigRejectsOldClients(t *testing.T) {
+	config, err := MakeTLSConfig(TLSConfig{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = config
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	// a client limited to TLS 1.1 should fail the handshake
+	oldTransport := server.Client().Transport.(*http.Transport).Clone()
+	oldTransport.TLSClientConfig.MaxVersion = tls.VersionTLS11
+	oldClient := &http.Client{Transport: oldTransport}
+	if resp, err := oldClient.Get(server.URL); err == nil {
+		resp.Body.Close()
+		t.Fatal("expected TLS 1.1 client to be rejected")
+	}
+
+	// while a modern client should succeed
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error from TLS 1.2+ client: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestLoadCertPool(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(backend.Close)
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: backend.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	bogusFile := filepath.Join(dir, "bogus.pem")
+	if err := os.WriteFile(bogusFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	pool, err := LoadCertPool([]string{caFile})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}}}
+	resp, err := client.Get(backend.URL)
+	if err != nil {
+		t.Fatalf("expected loaded CA to be trusted: %v", err)
+	}
+	resp.Body.Close()
+
+	for _, files := range [][]string{{bogusFile}, {filepath.Join(dir, "missing.pem")}} {
+		if _, err := LoadCertPool(files); err == nil {
+			t.Fatalf("expected error loading %v", files)
+		}
+	}
+}
+
+func TestLoadCertPoolWithoutSystemPool(t *testing.T) {
+	systemCertPool = func() (*x509.CertPool, error) {
+		return nil, errors.New("no system pool")
+	}
+	t.Cleanup(func() { systemCertPool = x509.SystemCertPool })
+	pool, err := LoadCertPool(nil)
+	if err != nil || pool == nil {
+		t.Fatalf("expected empty pool, got: %v, %v", pool, err)
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/time/rate"
+	"k8s.io/klog/v2"
+)
+
+// neighborWarmer warms the blob existence cache for neighboring regions
+// in the background, since nearby clients are likely to want the same blobs
+//
+// A nil *neighborWarmer is valid and does nothing.
+type neighborWarmer struct {
+	blobs   blobChecker
+	limiter *rate.Limiter
+	pool    *WorkerPool
+}
+
+// newNeighborWarmer returns a warmer probing at most limit blobs per second,
+// or nil, disabling warming, if limit is not positive
+func newNeighborWarmer(blobs blobChecker, limit rate.Limit, pool *WorkerPool) *neighborWarmer {
+	if limit <= 0 {
+		return nil
+	}
+	return &neighborWarmer{
+		blobs:   blobs,
+		limiter: rate.NewLimiter(limit, max(1, int(limit))),
+		pool:    pool,
+	}
+}
+
+// ValidateNeighborWarmQPS returns an error if qps is negative
+func ValidateNeighborWarmQPS(qps float64) error {
+	if qps < 0 {
+		return fmt.Errorf("invalid neighbor warm QPS %v, expected 0 or more", qps)
+	}
+	return nil
+}
+
+// Enqueue queues probing blobURL on the background pool without blocking,
+// if the rate limit is exceeded or the queue is full the probe is dropped
+// and false is returned
+//
+// Probes are dropped rather than delayed by the rate limit so that warming
+// never holds background workers other tasks could use.
+func (n *neighborWarmer) Enqueue(blobURL string) bool {
+	if n == nil {
+		return false
+	}
+	if !n.limiter.Allow() {
+		klog.V(3).InfoS("neighbor warmer rate limited, dropping probe", "url", blobURL)
+		return false
+	}
+	if !n.pool.Submit(func() { n.warm(blobURL) }) {
+		klog.V(3).InfoS("background queue full, dropping neighbor probe", "url", blobURL)
+		return false
+	}
+	return true
+}
+
+func (n *neighborWarmer) warm(blobURL string) {
+	exists, err := n.blobs.BlobExists(context.Background(), blobURL)
+	klog.V(3).InfoS("warmed neighbor blob existence", "url", blobURL, "exists", exists, "err", err)
+}
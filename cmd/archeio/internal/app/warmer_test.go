@@ -0,0 +1,200 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// recordingBlobsChecker reports every probed URL on probed
+type recordingBlobsChecker struct {
+	knownURLs map[string]bool
+	probed    chan string
+}
+
+func newRecordingBlobsChecker(knownURLs map[string]bool) *recordingBlobsChecker {
+	return &recordingBlobsChecker{
+		knownURLs: knownURLs,
+		probed:    make(chan string, 100),
+	}
+}
+
+func (f *recordingBlobsChecker) BlobExists(_ context.Context, blobURL string) (bool, error) {
+	f.probed <- blobURL
+	return f.knownURLs[blobURL], nil
+}
+
+func TestNeighborWarmerEnqueue(t *testing.T) {
+	t.Parallel()
+	var nilWarmer *neighborWarmer
+	if nilWarmer.Enqueue("a") {
+		t.Fatal("expected nil warmer to drop probes")
+	}
+	// no workers, so queued probes stay queued
+	w := newNeighborWarmer(newRecordingBlobsChecker(nil), rate.Inf, newWorkerPool(0, 1))
+	if !w.Enqueue("a") {
+		t.Fatal("expected probe to be queued")
+	}
+	if w.Enqueue("b") {
+		t.Fatal("expected probe to be dropped when the queue is full")
+	}
+}
+
+func TestNewNeighborWarmerDisabled(t *testing.T) {
+	t.Parallel()
+	for _, limit := range []rate.Limit{0, -1} {
+		if w := newNeighborWarmer(newRecordingBlobsChecker(nil), limit, newWorkerPool(1, 10)); w != nil {
+			t.Fatalf("expected no warmer for limit %v", limit)
+		}
+	}
+}
+
+func TestValidateNeighborWarmQPS(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		Name        string
+		QPS         float64
+		ExpectError bool
+	}{
+		{
+			Name: "disabled",
+		},
+		{
+			Name: "limited",
+			QPS:  10,
+		},
+		{
+			Name:        "negative",
+			QPS:         -1,
+			ExpectError: true,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			err := ValidateNeighborWarmQPS(tc.QPS)
+			if tc.ExpectError && err == nil {
+				t.Fatal("expected error but got none")
+			} else if !tc.ExpectError && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestNeighborWarmerRateLimit(t *testing.T) {
+	t.Parallel()
+	blobs := newRecordingBlobsChecker(nil)
+	// allows the initial burst of one probe and then none for the test
+	w := newNeighborWarmer(blobs, rate.Every(time.Hour), newWorkerPool(1, 10))
+	if !w.Enqueue("a") {
+		t.Fatal("expected first probe to be queued")
+	}
+	for _, blobURL := range []string{"b", "c"} {
+		if w.Enqueue(blobURL) {
+			t.Fatalf("expected rate limit to drop probe %q", blobURL)
+		}
+	}
+	if probed := <-blobs.probed; probed != "a" {
+		t.Fatalf("expected probe to be %q, but got %q", "a", probed)
+	}
+}
+
+func TestMakeV2HandlerNeighborRegions(t *testing.T) {
+	const blobPath = "/v2/pause/blobs/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	const euWest3BlobURL = "https://prod-registry-k8s-io-eu-west-3.s3.dualstack.eu-west-3.amazonaws.com/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	const euWest1BlobURL = "https://prod-registry-k8s-io-eu-west-1.s3.dualstack.eu-west-1.amazonaws.com/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	const euCentral1BlobURL = "https://prod-registry-k8s-io-eu-central-1.s3.dualstack.eu-central-1.amazonaws.com/containers/images/sha256:da86e6ba6ca197bf6bc5e9d900febd906b133eaa4750e6bed647b0fbe50ed43e"
+	registryConfig := RegistryConfig{
+		UpstreamRegistryEndpoint: "https://k8s.gcr.io",
+		ProxyBlobRegions:         []string{"eu-west-3"},
+		NeighborRegions: map[string][]string{
+			"eu-west-1": {"eu-west-3", "eu-west-1"},
+			"eu-west-3": {"eu-west-1", "eu-central-1"},
+		},
+		NeighborWarmQPS: 1000,
+	}
+	testCases := []struct {
+		Name           string
+		RemoteAddr     string
+		ExpectedProbes []string
+	}{
+		{
+			Name:           "redirected",
+			RemoteAddr:     "52.208.1.1:888",
+			ExpectedProbes: []string{euWest1BlobURL, euWest3BlobURL},
+		},
+		{
+			Name:           "proxied",
+			RemoteAddr:     "35.180.1.1:888",
+			ExpectedProbes: []string{euWest3BlobURL, euWest1BlobURL, euCentral1BlobURL},
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			blobs := newRecordingBlobsChecker(map[string]bool{
+				euWest3BlobURL: true,
+				euWest1BlobURL: true,
+			})
+			handler := makeV2Handler(context.Background(), registryConfig, blobs, &fakeBlobProxy{}, nil, nil, nil)
+			r := httptest.NewRequest("GET", "http://localhost:8080"+blobPath, nil)
+			r.RemoteAddr = tc.RemoteAddr
+			recorder := httptest.NewRecorder()
+			handler(recorder, r)
+			if status := recorder.Result().StatusCode; status != http.StatusOK && status != http.StatusTemporaryRedirect {
+				t.Fatalf("unexpected status: %d", status)
+			}
+			// the first probe is serving the request, the rest are warming
+			// concurrently so may happen in any order
+			probes := []string{}
+			for range tc.ExpectedProbes {
+				select {
+				case probed := <-blobs.probed:
+					probes = append(probes, probed)
+				case <-time.After(5 * time.Second):
+					t.Fatalf("timed out waiting for probes, got: %v", probes)
+				}
+			}
+			if probes[0] != tc.ExpectedProbes[0] {
+				t.Fatalf("expected serving probe: %q, but got: %q", tc.ExpectedProbes[0], probes[0])
+			}
+			sort.Strings(probes[1:])
+			expected := slices.Clone(tc.ExpectedProbes)
+			sort.Strings(expected[1:])
+			if !reflect.DeepEqual(probes, expected) {
+				t.Fatalf("expected probes: %v, but got: %v", expected, probes)
+			}
+			select {
+			case probed := <-blobs.probed:
+				t.Fatalf("unexpected probe: %q", probed)
+			case <-time.After(50 * time.Millisecond):
+			}
+		})
+	}
+}
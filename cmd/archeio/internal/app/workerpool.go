@@ -0,0 +1,90 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import "sync"
+
+// WorkerPool runs background tasks on at most a fixed number of goroutines,
+// queueing tasks submitted while all of them are busy
+//
+// Workers are started on demand and exit once the queue is empty, so an idle
+// pool holds no goroutines. Tasks should be short, as each holds a worker
+// until it returns, so long running loops should have their own goroutine.
+type WorkerPool struct {
+	maxWorkers int
+	queueSize  int
+
+	mu      sync.Mutex
+	running int
+	queue   []func()
+}
+
+// NewBackgroundPool returns a pool for background tasks of at most
+// maxWorkers goroutines, or defaultBackgroundWorkers if maxWorkers <= 0
+func NewBackgroundPool(maxWorkers int) *WorkerPool {
+	if maxWorkers <= 0 {
+		maxWorkers = defaultBackgroundWorkers
+	}
+	return newWorkerPool(maxWorkers, backgroundQueueSize)
+}
+
+func newWorkerPool(maxWorkers, queueSize int) *WorkerPool {
+	return &WorkerPool{
+		maxWorkers: maxWorkers,
+		queueSize:  queueSize,
+	}
+}
+
+// Submit runs task on a new worker if the pool is below its cap, or else
+// queues it without blocking, if the queue is full the task is dropped and
+// false is returned
+func (p *WorkerPool) Submit(task func()) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case p.running < p.maxWorkers:
+		p.running++
+		go p.work(task)
+	case len(p.queue) < p.queueSize:
+		p.queue = append(p.queue, task)
+	default:
+		return false
+	}
+	return true
+}
+
+// Running returns the number of running workers
+func (p *WorkerPool) Running() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.running
+}
+
+// work runs task and then queued tasks until the queue is empty
+func (p *WorkerPool) work(task func()) {
+	for task != nil {
+		task()
+		p.mu.Lock()
+		task = nil
+		if len(p.queue) > 0 {
+			task, p.queue = p.queue[0], p.queue[1:]
+		} else {
+			p.running--
+		}
+		p.mu.Unlock()
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolCap(t *testing.T) {
+	t.Parallel()
+	const maxWorkers, queueSize = 2, 3
+	p := newWorkerPool(maxWorkers, queueSize)
+	release := make(chan struct{})
+	started := make(chan struct{}, maxWorkers+queueSize)
+	var running, maxRunning atomic.Int64
+	task := func() {
+		n := running.Add(1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		started <- struct{}{}
+		<-release
+		running.Add(-1)
+	}
+	// the first tasks start workers up to the cap
+	for i := 0; i < maxWorkers; i++ {
+		if !p.Submit(task) {
+			t.Fatalf("expected task %d to be accepted", i)
+		}
+		<-started
+	}
+	// further tasks queue behind the busy workers rather than starting more
+	for i := 0; i < queueSize; i++ {
+		if !p.Submit(task) {
+			t.Fatalf("expected task %d to be queued", maxWorkers+i)
+		}
+	}
+	if p.Running() != maxWorkers {
+		t.Fatalf("expected %d running workers, got %d", maxWorkers, p.Running())
+	}
+	// and beyond the queue they are dropped
+	if p.Submit(task) {
+		t.Fatal("expected task to be dropped when the queue is full")
+	}
+	select {
+	case <-started:
+		t.Fatal("expected queued task not to start while workers are busy")
+	case <-time.After(50 * time.Millisecond):
+	}
+	// queued tasks run once workers are free, still within the cap
+	close(release)
+	for i := 0; i < queueSize; i++ {
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for queued tasks")
+		}
+	}
+	if m := maxRunning.Load(); m != maxWorkers {
+		t.Fatalf("expected at most %d tasks running at once, got %d", maxWorkers, m)
+	}
+	// idle workers exit
+	deadline := time.Now().Add(5 * time.Second)
+	for p.Running() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected idle workers to exit, %d running", p.Running())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestNewBackgroundPool(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		Name       string
+		MaxWorkers int
+		Expected   int
+	}{
+		{Name: "unset", MaxWorkers: 0, Expected: defaultBackgroundWorkers},
+		{Name: "negative", MaxWorkers: -1, Expected: defaultBackgroundWorkers},
+		{Name: "set", MaxWorkers: 3, Expected: 3},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			p := NewBackgroundPool(tc.MaxWorkers)
+			if p.maxWorkers != tc.Expected {
+				t.Fatalf("expected %d max workers, got %d", tc.Expected, p.maxWorkers)
+			}
+			if p.queueSize != backgroundQueueSize {
+				t.Fatalf("expected queue size %d, got %d", backgroundQueueSize, p.queueSize)
+			}
+		})
+	}
+}
@@ -18,16 +18,25 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
 	"k8s.io/klog/v2"
 
 	"k8s.io/registry.k8s.io/cmd/archeio/internal/app"
+	"k8s.io/registry.k8s.io/pkg/net/cloudcidrs"
 )
 
 func main() {
@@ -36,54 +45,451 @@ func main() {
 	flag.Parse()
 	defer klog.Flush()
 
+	// refuse to route clients with corrupted IP range data
+	if err := cloudcidrs.VerifyIntegrity(); err != nil {
+		klog.Fatal(err)
+	}
+
+	// configuration may also be loaded from a file, which unlike the process
+	// environment can be changed and reloaded with SIGHUP
+	envFile := getEnv("ENV_FILE", "")
+	if err := loadEnvFile(envFile); err != nil {
+		klog.Fatal(err)
+	}
+
 	// cloud run expects us to listen to HTTP on $PORT
 	// https://cloud.google.com/run/docs/container-contract#port
 	port := getEnv("PORT", "8080")
 
-	// make it possible to override k8s.gcr.io without rebuilding in the future
-	registryConfig := app.RegistryConfig{
-		UpstreamRegistryEndpoint: getEnv("UPSTREAM_REGISTRY_ENDPOINT", "https://us-central1-docker.pkg.dev"),
-		UpstreamRegistryPath:     getEnv("UPSTREAM_REGISTRY_PATH", "k8s-artifacts-prod/images"),
-		InfoURL:                  "https://github.com/kubernetes/registry.k8s.io",
-		PrivacyURL:               "https://www.linuxfoundation.org/privacy-policy/",
-		DefaultAWSBaseURL:        getEnv("DEFAULT_AWS_BASE_URL", "https://prod-registry-k8s-io-us-east-1.s3.dualstack.us-east-1.amazonaws.com"),
+	// short background tasks run on this pool, shared across reloads
+	backgroundPool := app.NewBackgroundPool(getEnvInt("BACKGROUND_WORKERS", 10))
+
+	registryConfig, err := loadRegistryConfig(backgroundPool)
+	if err != nil {
+		klog.Fatal(err)
 	}
 
-	// configure server with reasonable timeout
-	// we only serve redirects, 10s should be sufficient
+	handler := app.NewReloadableHandler(app.MakeHandler(registryConfig))
+
+	// configure server with reasonable timeouts
+	// redirects are served quickly, but proxied blobs stream the whole layer
+	// so need much longer to write, see WRITE_TIMEOUT
+	writeTimeout := 10 * time.Second
+	if len(registryConfig.ProxyBlobRegions) > 0 {
+		writeTimeout = 30 * time.Minute
+	}
 	server := &http.Server{
 		Addr:              ":" + port,
-		Handler:           app.MakeHandler(registryConfig),
+		Handler:           handler,
 		ReadTimeout:       10 * time.Second,
 		ReadHeaderTimeout: 2 * time.Second,
+		WriteTimeout:      getEnvDuration("WRITE_TIMEOUT", writeTimeout),
 	}
 
 	// signal handler for graceful shutdown
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
+	// in cloud run TLS is terminated by the loadbalancer, but other
+	// deployments may need archeio to terminate TLS itself
+	tlsCertFile := getEnv("TLS_CERT_FILE", "")
+	tlsKeyFile := getEnv("TLS_KEY_FILE", "")
+	if tlsCertFile != "" || tlsKeyFile != "" {
+		tlsConfig, err := app.MakeTLSConfig(app.TLSConfig{
+			MinVersion:   getEnv("TLS_MIN_VERSION", ""),
+			CipherSuites: getEnvList("TLS_CIPHER_SUITES"),
+		})
+		if err != nil {
+			klog.Fatal(err)
+		}
+		server.TLSConfig = tlsConfig
+	}
+
+	if err := checkEnv(); err != nil {
+		klog.Fatal(err)
+	}
+
 	// start serving
 	go func() {
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if server.TLSConfig != nil {
+			err = server.ListenAndServeTLS(tlsCertFile, tlsKeyFile)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			klog.Fatal(err)
 		}
 	}()
+	// optionally serve metrics on a separate port, so they are not public
+	var metricsServer *http.Server
+	if metricsPort := getEnv("METRICS_PORT", ""); metricsPort != "" {
+		metricsServer = &http.Server{
+			Addr:              ":" + metricsPort,
+			Handler:           app.MetricsHandler(getEnvBool("METRICS_OPENMETRICS", false)),
+			ReadHeaderTimeout: 2 * time.Second,
+		}
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				klog.Fatal(err)
+			}
+		}()
+		klog.InfoS("serving metrics", "port", metricsPort)
+	}
+	// optionally capture rolling CPU profiles, for catching intermittent issues
+	profilerCtx, stopProfiler := context.WithCancel(context.Background())
+	defer stopProfiler()
+	if profileDir := getEnv("CPU_PROFILE_DIR", ""); profileDir != "" {
+		profilerConfig := app.ProfilerConfig{
+			Dir:      profileDir,
+			Duration: getEnvDuration("CPU_PROFILE_DURATION", 10*time.Second),
+			Interval: getEnvDuration("CPU_PROFILE_INTERVAL", 5*time.Minute),
+			Keep:     getEnvInt("CPU_PROFILE_KEEP", 12),
+		}
+		if err := app.ValidateProfilerConfig(profilerConfig); err != nil {
+			envErrs = append(envErrs, err)
+		}
+		// the profiler must not start with invalid settings, e.g. a zero
+		// interval would panic
+		if err := checkEnv(); err != nil {
+			klog.Fatal(err)
+		}
+		go app.RunProfiler(profilerCtx, profilerConfig)
+		klog.InfoS("capturing CPU profiles", "dir", profileDir)
+	}
+	if err := checkEnv(); err != nil {
+		klog.Fatal(err)
+	}
+
+	// the handler can be rebuilt on SIGHUP, with fresh state such as the blob
+	// existence cache and with configuration reloaded from ENV_FILE
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			rc, err := reloadRegistryConfig(envFile, backgroundPool)
+			if err != nil {
+				klog.ErrorS(err, "failed to reload configuration, keeping current handler")
+				continue
+			}
+			ready := func(h http.Handler) error {
+				return app.CheckReady(rc, h)
+			}
+			if err := handler.Reload(app.MakeHandler(rc), ready); err != nil {
+				klog.ErrorS(err, "failed to reload handler")
+				continue
+			}
+			klog.InfoS("reloaded handler", "configuration", rc)
+			app.LogStartupSummary(rc)
+		}
+	}()
+
 	klog.InfoS("listening", "port", port)
 	klog.InfoS("registry", "configuration", registryConfig)
+	app.LogStartupSummary(registryConfig)
 
 	// Graceful shutdown
 	<-done
+	stopProfiler()
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := server.Shutdown(ctx); err != nil {
 		klog.Fatalf("Server didn't exit gracefully %v", err)
 	}
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(ctx); err != nil {
+			klog.Fatalf("Metrics server didn't exit gracefully %v", err)
+		}
+	}
 }
 
-// getEnv returns defaultValue if key is not set, else the value of os.LookupEnv(key)
+// loadRegistryConfig returns the app.RegistryConfig from the environment,
+// running background tasks on backgroundPool, or an error if it is not valid
+func loadRegistryConfig(backgroundPool *app.WorkerPool) (app.RegistryConfig, error) {
+	// make it possible to override k8s.gcr.io without rebuilding in the future
+	registryConfig := app.RegistryConfig{
+		UpstreamRegistryEndpoint: getEnv("UPSTREAM_REGISTRY_ENDPOINT", "https://us-central1-docker.pkg.dev"),
+		UpstreamRegistryPath:     getEnv("UPSTREAM_REGISTRY_PATH", "k8s-artifacts-prod/images"),
+		InfoURL:                  "https://github.com/kubernetes/registry.k8s.io",
+		PrivacyURL:               "https://www.linuxfoundation.org/privacy-policy/",
+		DefaultAWSBaseURL:        getEnv("DEFAULT_AWS_BASE_URL", "https://prod-registry-k8s-io-us-east-1.s3.dualstack.us-east-1.amazonaws.com"),
+		SelfRegion:               getSelfRegion(),
+		ProxyBlobRegions:         getEnvList("PROXY_BLOB_REGIONS"),
+		ProxyBlobGzip:            getEnvBool("PROXY_BLOB_GZIP", false),
+		BlobAlternateLinks:       getEnvInt("BLOB_ALTERNATE_LINKS", 0),
+		AdminToken:               getEnv("ADMIN_TOKEN", ""),
+		SlowRequestsLimit:        getEnvInt("SLOW_REQUESTS_LIMIT", 20),
+		BlobCacheTTL:             getEnvDuration("BLOB_CACHE_TTL", 0),
+		ServeStaleOnError:        getEnvBool("SERVE_STALE_ON_ERROR", false),
+		DisableBlobCache:         getEnvBool("DISABLE_BLOB_CACHE", false),
+		BlobCacheMinSize:         int64(getEnvInt("BLOB_CACHE_MIN_SIZE", 0)),
+		VerifyBlobETag:           getEnvBool("VERIFY_BLOB_ETAG", false),
+		ForbiddenBlobExists:      getEnvBool("FORBIDDEN_BLOB_EXISTS", false),
+
+		RepeatedBlobRequestThreshold: getEnvInt("REPEATED_BLOB_REQUEST_THRESHOLD", 0),
+		NeighborWarmQPS:              getEnvFloat("NEIGHBOR_WARM_QPS", 10),
+		BackgroundPool:               backgroundPool,
+		AllowedDigestAlgorithms:      getEnvList("ALLOWED_DIGEST_ALGORITHMS"),
+		FallbackProbeRatio:           getEnvFloat("FALLBACK_PROBE_RATIO", 0),
+		DisableUpstreamBlobFallback:  getEnvBool("DISABLE_UPSTREAM_BLOB_FALLBACK", false),
+		MaxForwardedForEntries:       getEnvInt("MAX_FORWARDED_FOR_ENTRIES", 20),
+		CostAwareRouting:             getEnvBool("COST_AWARE_ROUTING", false),
+		CostWeight:                   getEnvFloat("COST_WEIGHT", 0.5),
+		CostTieBreaker:               getEnvChoice("COST_TIE_BREAKER", app.TieBreakOrder, app.TieBreakDigest),
+		EgressCostHeaders:            getEnvBool("EGRESS_COST_HEADERS", false),
+		EgressCostTrustedCIDRs:       getEnvPrefixes("EGRESS_COST_TRUSTED_CIDRS"),
+		ErrorLogQPS:                  getEnvFloat("ERROR_LOG_QPS", 0),
+		RoutingLogFormat:             getEnvChoice("ROUTING_LOG_FORMAT", "", app.RoutingLogFormatV1),
+		MaintenanceWarning:           getEnv("MAINTENANCE_WARNING", ""),
+		MaintenanceStart:             getEnvTime("MAINTENANCE_START"),
+		MaintenanceEnd:               getEnvTime("MAINTENANCE_END"),
+	}
+	// per-backend options are structured, so these are configured as JSON
+	getEnvJSON("BACKENDS", &registryConfig.Backends)
+	getEnvJSON("NEIGHBOR_REGIONS", &registryConfig.NeighborRegions)
+	getEnvJSON("EGRESS_COST_PER_GB", &registryConfig.EgressCostPerGB)
+	getEnvJSON("PROTOCOL_BACKENDS", &registryConfig.ProtocolBackends)
+	getEnvJSON("REDIRECT_STATUS_OVERRIDES", &registryConfig.RedirectStatusOverrides)
+	if err := checkEnv(); err != nil {
+		return app.RegistryConfig{}, err
+	}
+	if err := app.ValidateRedirectStatusOverrides(registryConfig.RedirectStatusOverrides); err != nil {
+		return app.RegistryConfig{}, err
+	}
+	if err := app.ValidateCostWeight(registryConfig.CostWeight); err != nil {
+		return app.RegistryConfig{}, err
+	}
+	if err := app.ValidateBlobAlternateLinks(registryConfig.BlobAlternateLinks); err != nil {
+		return app.RegistryConfig{}, err
+	}
+	if err := app.ValidateDigestAlgorithms(registryConfig.AllowedDigestAlgorithms); err != nil {
+		return app.RegistryConfig{}, err
+	}
+	if err := app.ValidateNeighborWarmQPS(registryConfig.NeighborWarmQPS); err != nil {
+		return app.RegistryConfig{}, err
+	}
+	if err := app.ValidateMaxForwardedForEntries(registryConfig.MaxForwardedForEntries); err != nil {
+		return app.RegistryConfig{}, err
+	}
+
+	// backends using an internal CA need it trusted to be probed
+	if caFiles := getEnvList("PROBE_CA_FILES"); len(caFiles) > 0 {
+		pool, err := app.LoadCertPool(caFiles)
+		if err != nil {
+			return app.RegistryConfig{}, err
+		}
+		registryConfig.ProbeRootCAs = pool
+	}
+	return registryConfig, nil
+}
+
+// reloadRegistryConfig reloads envFile and then the app.RegistryConfig
+func reloadRegistryConfig(envFile string, backgroundPool *app.WorkerPool) (app.RegistryConfig, error) {
+	if err := loadEnvFile(envFile); err != nil {
+		return app.RegistryConfig{}, err
+	}
+	return loadRegistryConfig(backgroundPool)
+}
+
+// envFileValues are the values loaded from ENV_FILE, see lookupEnv
+var envFileValues map[string]string
+
+// loadEnvFile loads KEY=VALUE lines from path into envFileValues, replacing
+// any loaded before, blank lines and lines starting with # are ignored
+//
+// If path is "" nothing is loaded.
+func loadEnvFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	values := map[string]string{}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("invalid line %d in %s, expected KEY=VALUE", i+1, path)
+		}
+		values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	envFileValues = values
+	return nil
+}
+
+// lookupEnv is os.LookupEnv, with values from ENV_FILE taking precedence
+func lookupEnv(key string) (string, bool) {
+	if value, ok := envFileValues[key]; ok {
+		return value, true
+	}
+	return os.LookupEnv(key)
+}
+
+// envErrs are the invalid values seen by the getEnv helpers, see checkEnv
+var envErrs []error
+
+// invalidEnv records that the value of key is not valid
+func invalidEnv(key string, err error) {
+	envErrs = append(envErrs, fmt.Errorf("invalid value for %s: %w", key, err))
+}
+
+// checkEnv returns any invalid values seen since it was last called
+func checkEnv() error {
+	err := errors.Join(envErrs...)
+	envErrs = nil
+	return err
+}
+
+// getEnv returns defaultValue if key is not set, else the value of lookupEnv(key)
 func getEnv(key, defaultValue string) string {
-	if value, ok := os.LookupEnv(key); ok {
+	if value, ok := lookupEnv(key); ok {
 		return value
 	}
 	return defaultValue
 }
+
+// getEnvInt returns defaultValue if key is not set, else the integer value of
+// lookupEnv(key), recording an error for checkEnv if it is not valid
+func getEnvInt(key string, defaultValue int) int {
+	value, ok := lookupEnv(key)
+	if !ok {
+		return defaultValue
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		invalidEnv(key, err)
+	}
+	return i
+}
+
+// getEnvFloat returns defaultValue if key is not set, else the float value of
+// lookupEnv(key), recording an error for checkEnv if it is not valid
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value, ok := lookupEnv(key)
+	if !ok {
+		return defaultValue
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		invalidEnv(key, err)
+	}
+	return f
+}
+
+// getEnvBool returns defaultValue if key is not set, else the boolean value of
+// lookupEnv(key), recording an error for checkEnv if it is not valid
+func getEnvBool(key string, defaultValue bool) bool {
+	value, ok := lookupEnv(key)
+	if !ok {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		invalidEnv(key, err)
+	}
+	return b
+}
+
+// getEnvDuration returns defaultValue if key is not set, else the duration
+// value of lookupEnv(key), recording an error for checkEnv if it is not a
+// valid duration
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, ok := lookupEnv(key)
+	if !ok {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		invalidEnv(key, err)
+	}
+	return d
+}
+
+// getEnvTime returns the RFC 3339 time lookupEnv(key), or the zero time
+// if key is not set, recording an error for checkEnv if it is not valid
+func getEnvTime(key string) time.Time {
+	value, ok := lookupEnv(key)
+	if !ok {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		invalidEnv(key, err)
+	}
+	return t
+}
+
+// getEnvJSON decodes the JSON value of lookupEnv(key) into v if key is set,
+// recording an error for checkEnv if it is not valid
+func getEnvJSON(key string, v any) {
+	value, ok := lookupEnv(key)
+	if !ok {
+		return
+	}
+	if err := json.Unmarshal([]byte(value), v); err != nil {
+		invalidEnv(key, err)
+	}
+}
+
+// getEnvList returns the comma separated values of lookupEnv(key), with
+// surrounding whitespace trimmed, or nil if key is not set
+func getEnvList(key string) []string {
+	value := getEnv(key, "")
+	if value == "" {
+		return nil
+	}
+	values := strings.Split(value, ",")
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
+	}
+	return values
+}
+
+// getSelfRegion returns the AWS region archeio is running in from
+// $SELF_REGION, or if that is "auto" from the EC2 instance metadata service
+func getSelfRegion() string {
+	region := getEnv("SELF_REGION", "")
+	if region != "auto" {
+		return region
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	output, err := imds.New(imds.Options{}).GetRegion(ctx, &imds.GetRegionInput{})
+	if err != nil {
+		// not fatal, we just can't use it for routing
+		klog.ErrorS(err, "failed to detect AWS region from instance metadata")
+		return ""
+	}
+	return output.Region
+}
+
+// getEnvPrefixes returns the comma separated CIDRs of lookupEnv(key),
+// recording an error for checkEnv if any are not valid
+func getEnvPrefixes(key string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, value := range getEnvList(key) {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			invalidEnv(key, err)
+			continue
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes
+}
+
+// getEnvChoice returns defaultValue if key is not set, else the value of
+// lookupEnv(key), recording an error for checkEnv if it is neither
+// defaultValue nor one of choices
+func getEnvChoice(key, defaultValue string, choices ...string) string {
+	value := getEnv(key, defaultValue)
+	if value != defaultValue && !slices.Contains(choices, value) {
+		invalidEnv(key, fmt.Errorf("%q, expected one of %q", value, append([]string{defaultValue}, choices...)))
+	}
+	return value
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fakebackend_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	"k8s.io/registry.k8s.io/internal/fakebackend"
+)
+
+func Example() {
+	backend := fakebackend.New()
+	digest := backend.PutBlob("pause", []byte("layer"))
+	// simulate a bucket that has not been synced yet
+	backend.SetStatus("/containers/images/"+digest, http.StatusNotFound)
+	server := httptest.NewServer(backend)
+	defer server.Close()
+
+	for _, url := range []string{
+		server.URL + "/v2/pause/blobs/" + digest,
+		server.URL + "/containers/images/" + digest,
+	} {
+		resp, err := http.Get(url)
+		if err != nil {
+			panic(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		fmt.Println(resp.StatusCode, string(body))
+	}
+	// Output:
+	// 200 layer
+	// 404 Not Found
+}
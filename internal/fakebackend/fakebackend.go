@@ -0,0 +1,156 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fakebackend provides an in-memory fake of the OCI registry and S3
+// bucket backends archeio redirects clients to, for writing handler and e2e
+// tests without cloud access.
+//
+// Serve a Backend with httptest.NewServer and point archeio's
+// UpstreamRegistryEndpoint and DefaultAWSBaseURL (or BACKENDS) at it.
+package fakebackend
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+)
+
+// blobPathPrefix is the path blobs are stored under in our buckets
+const blobPathPrefix = "/containers/images/"
+
+// Object is content served by a Backend at a path
+type Object struct {
+	Content     []byte
+	ContentType string
+	// Status, if set, is served instead of the content, e.g. to simulate
+	// a backend error or a 403 from a misconfigured bucket
+	Status int
+	// Latency delays the response, e.g. to simulate a slow backend
+	Latency time.Duration
+}
+
+// Backend is an http.Handler serving Objects from memory
+//
+// GET and HEAD are supported, including Range requests. Unknown paths are
+// 404, except /v2/ which is 200 as for a public registry.
+type Backend struct {
+	mu      sync.RWMutex
+	objects map[string]Object
+}
+
+// New returns an empty Backend
+func New() *Backend {
+	return &Backend{
+		objects: map[string]Object{},
+	}
+}
+
+// Put serves object at urlPath, replacing any existing object
+func (b *Backend) Put(urlPath string, object Object) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.objects[urlPath] = object
+}
+
+// PutBlob serves content as a blob of repository, both at the OCI registry
+// path and the bucket path archeio probes, and returns its digest
+func (b *Backend) PutBlob(repository string, content []byte) string {
+	digest := Digest(content)
+	object := Object{Content: content, ContentType: "application/octet-stream"}
+	b.Put(path.Join("/v2", repository, "blobs", digest), object)
+	b.Put(blobPathPrefix+digest, object)
+	return digest
+}
+
+// PutManifest serves content as a manifest of repository by reference
+// (e.g. a tag) and by digest, and returns its digest
+func (b *Backend) PutManifest(repository, reference, mediaType string, content []byte) string {
+	digest := Digest(content)
+	object := Object{Content: content, ContentType: mediaType}
+	b.Put(path.Join("/v2", repository, "manifests", reference), object)
+	b.Put(path.Join("/v2", repository, "manifests", digest), object)
+	return digest
+}
+
+// SetStatus serves status instead of the object at urlPath, or if status is
+// 0 serves the object normally again, returning false if there is no object
+func (b *Backend) SetStatus(urlPath string, status int) bool {
+	return b.update(urlPath, func(object *Object) { object.Status = status })
+}
+
+// SetLatency delays responses for the object at urlPath, returning false if
+// there is no object
+func (b *Backend) SetLatency(urlPath string, latency time.Duration) bool {
+	return b.update(urlPath, func(object *Object) { object.Latency = latency })
+}
+
+func (b *Backend) update(urlPath string, f func(*Object)) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	object, ok := b.objects[urlPath]
+	if ok {
+		f(&object)
+		b.objects[urlPath] = object
+	}
+	return ok
+}
+
+// ServeHTTP implements http.Handler
+func (b *Backend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Only GET and HEAD are allowed.", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.URL.Path == "/v2/" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	b.mu.RLock()
+	object, ok := b.objects[r.URL.Path]
+	b.mu.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if object.Latency > 0 {
+		timer := time.NewTimer(object.Latency)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if object.Status != 0 {
+		http.Error(w, http.StatusText(object.Status), object.Status)
+		return
+	}
+	if object.ContentType != "" {
+		w.Header().Set("Content-Type", object.ContentType)
+	}
+	w.Header().Set("Docker-Content-Digest", Digest(object.Content))
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(object.Content))
+}
+
+// Digest returns the OCI sha256 digest of content
+func Digest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
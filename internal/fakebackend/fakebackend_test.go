@@ -0,0 +1,207 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fakebackend
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBackend(t *testing.T) {
+	t.Parallel()
+	b := New()
+	blobDigest := b.PutBlob("pause", []byte("0123456789"))
+	manifestDigest := b.PutManifest("pause", "3.9", "application/vnd.oci.image.manifest.v1+json", []byte("{}"))
+	b.Put("/error", Object{Content: []byte("hidden"), Status: http.StatusForbidden})
+	b.Put("/untyped", Object{Content: []byte("untyped")})
+	testCases := []struct {
+		Name                string
+		Method              string
+		Path                string
+		Range               string
+		ExpectedStatus      int
+		ExpectedBody        string
+		ExpectedContentType string
+		ExpectedDigest      string
+	}{
+		{
+			Name:           "API check",
+			Method:         http.MethodGet,
+			Path:           "/v2/",
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			Name:                "registry blob",
+			Method:              http.MethodGet,
+			Path:                "/v2/pause/blobs/" + blobDigest,
+			ExpectedStatus:      http.StatusOK,
+			ExpectedBody:        "0123456789",
+			ExpectedContentType: "application/octet-stream",
+			ExpectedDigest:      blobDigest,
+		},
+		{
+			Name:                "bucket blob",
+			Method:              http.MethodHead,
+			Path:                "/containers/images/" + blobDigest,
+			ExpectedStatus:      http.StatusOK,
+			ExpectedContentType: "application/octet-stream",
+			ExpectedDigest:      blobDigest,
+		},
+		{
+			Name:                "blob range",
+			Method:              http.MethodGet,
+			Path:                "/containers/images/" + blobDigest,
+			Range:               "bytes=2-4",
+			ExpectedStatus:      http.StatusPartialContent,
+			ExpectedBody:        "234",
+			ExpectedContentType: "application/octet-stream",
+			ExpectedDigest:      blobDigest,
+		},
+		{
+			Name:                "manifest by tag",
+			Method:              http.MethodGet,
+			Path:                "/v2/pause/manifests/3.9",
+			ExpectedStatus:      http.StatusOK,
+			ExpectedBody:        "{}",
+			ExpectedContentType: "application/vnd.oci.image.manifest.v1+json",
+			ExpectedDigest:      manifestDigest,
+		},
+		{
+			Name:                "manifest by digest",
+			Method:              http.MethodGet,
+			Path:                "/v2/pause/manifests/" + manifestDigest,
+			ExpectedStatus:      http.StatusOK,
+			ExpectedBody:        "{}",
+			ExpectedContentType: "application/vnd.oci.image.manifest.v1+json",
+			ExpectedDigest:      manifestDigest,
+		},
+		{
+			Name:                "no content type",
+			Method:              http.MethodGet,
+			Path:                "/untyped",
+			ExpectedStatus:      http.StatusOK,
+			ExpectedBody:        "untyped",
+			ExpectedContentType: "text/plain; charset=utf-8",
+			ExpectedDigest:      Digest([]byte("untyped")),
+		},
+		{
+			Name:                "configured error",
+			Method:              http.MethodGet,
+			Path:                "/error",
+			ExpectedStatus:      http.StatusForbidden,
+			ExpectedBody:        "Forbidden\n",
+			ExpectedContentType: "text/plain; charset=utf-8",
+		},
+		{
+			Name:                "unknown path",
+			Method:              http.MethodGet,
+			Path:                "/v2/pause/blobs/sha256:missing",
+			ExpectedStatus:      http.StatusNotFound,
+			ExpectedBody:        "404 page not found\n",
+			ExpectedContentType: "text/plain; charset=utf-8",
+		},
+		{
+			Name:                "mutation",
+			Method:              http.MethodPut,
+			Path:                "/v2/pause/blobs/" + blobDigest,
+			ExpectedStatus:      http.StatusMethodNotAllowed,
+			ExpectedBody:        "Only GET and HEAD are allowed.\n",
+			ExpectedContentType: "text/plain; charset=utf-8",
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			r := httptest.NewRequest(tc.Method, "http://localhost:8080"+tc.Path, nil)
+			if tc.Range != "" {
+				r.Header.Set("Range", tc.Range)
+			}
+			recorder := httptest.NewRecorder()
+			b.ServeHTTP(recorder, r)
+			if recorder.Code != tc.ExpectedStatus {
+				t.Fatalf("expected status: %d, but got status: %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if body := recorder.Body.String(); body != tc.ExpectedBody {
+				t.Fatalf("expected body: %q, but got: %q", tc.ExpectedBody, body)
+			}
+			if contentType := recorder.Header().Get("Content-Type"); contentType != tc.ExpectedContentType {
+				t.Fatalf("expected content type: %q, but got: %q", tc.ExpectedContentType, contentType)
+			}
+			if digest := recorder.Header().Get("Docker-Content-Digest"); digest != tc.ExpectedDigest {
+				t.Fatalf("expected digest: %q, but got: %q", tc.ExpectedDigest, digest)
+			}
+		})
+	}
+}
+
+func TestBackendSetStatus(t *testing.T) {
+	t.Parallel()
+	b := New()
+	b.Put("/object", Object{Content: []byte("content")})
+	if b.SetStatus("/missing", http.StatusInternalServerError) {
+		t.Fatal("expected setting status of a missing object to fail")
+	}
+	for _, status := range []int{http.StatusInternalServerError, 0} {
+		if !b.SetStatus("/object", status) {
+			t.Fatal("expected setting status to succeed")
+		}
+		recorder := httptest.NewRecorder()
+		b.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://localhost:8080/object", nil))
+		expected := status
+		if expected == 0 {
+			expected = http.StatusOK
+		}
+		if recorder.Code != expected {
+			t.Fatalf("expected status: %d, but got status: %d", expected, recorder.Code)
+		}
+	}
+}
+
+func TestBackendSetLatency(t *testing.T) {
+	t.Parallel()
+	b := New()
+	b.Put("/object", Object{Content: []byte("content")})
+	if b.SetLatency("/missing", time.Hour) {
+		t.Fatal("expected setting latency of a missing object to fail")
+	}
+	const latency = 20 * time.Millisecond
+	if !b.SetLatency("/object", latency) {
+		t.Fatal("expected setting latency to succeed")
+	}
+	start := time.Now()
+	recorder := httptest.NewRecorder()
+	b.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://localhost:8080/object", nil))
+	if elapsed := time.Since(start); elapsed < latency {
+		t.Fatalf("expected response after at least %v, but got it after %v", latency, elapsed)
+	}
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status: %d, but got status: %d", http.StatusOK, recorder.Code)
+	}
+	// clients giving up are not kept waiting
+	b.SetLatency("/object", time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	recorder = httptest.NewRecorder()
+	b.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://localhost:8080/object", nil).WithContext(ctx))
+	if recorder.Body.Len() != 0 {
+		t.Fatalf("expected no response to a canceled request, got: %q", recorder.Body.String())
+	}
+}
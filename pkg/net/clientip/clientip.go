@@ -36,6 +36,18 @@ import (
 //
 // At this time we have no need to complicate it further.
 func Get(r *http.Request) (netip.Addr, error) {
+	ip, _, err := GetLimited(r, 0)
+	return ip, err
+}
+
+// GetLimited is Get, but parses at most the last maxEntries entries of
+// X-Forwarded-For, bounding the work done for huge client-supplied headers.
+// maxEntries <= 0 means no limit.
+//
+// truncated reports if there were further entries that were not parsed,
+// these precede the entries we care about so the result is unaffected
+// as long as maxEntries >= 2.
+func GetLimited(r *http.Request, maxEntries int) (ip netip.Addr, truncated bool, err error) {
 	// Upstream docs:
 	// https://cloud.google.com/load-balancing/docs/https#x-forwarded-for_header
 	//
@@ -55,11 +67,8 @@ func Get(r *http.Request) (netip.Addr, error) {
 	// r.RemoteAddr in that case to support local testing
 	// Go http server will always set this value for us
 	if rawXFwdFor == "" {
-		host, _, err := net.SplitHostPort(r.RemoteAddr)
-		if err != nil {
-			return netip.Addr{}, err
-		}
-		return netip.ParseAddr(host)
+		ip, err := parseRemoteAddr(r.RemoteAddr)
+		return ip, false, err
 	}
 	// assume we are in cloud run, get <client-ip> from load balancer header
 	// local tests with direct connection to the server can also fake this
@@ -67,13 +76,63 @@ func Get(r *http.Request) (netip.Addr, error) {
 	//
 	// we want the contents between the second to last comma and the last comma
 	// or if only one comma between the start of the string and the last comma
-	keys := strings.FieldsFunc(rawXFwdFor, func(r rune) bool {
-		return r == ',' || r == ' '
-	})
+	//
+	// we parse from the end, as the entries we trust are appended last
+	keys, truncated := lastFields(rawXFwdFor, maxEntries)
 	// there should be at least two values: <client-ip>,<load-balancer-ip>
 	if len(keys) < 2 {
-		return netip.Addr{}, fmt.Errorf("invalid X-Forwarded-For value: %s", rawXFwdFor)
+		return netip.Addr{}, truncated, fmt.Errorf("invalid X-Forwarded-For value: %s", rawXFwdFor)
 	}
 	// normal case, we expect the client-ip to be 2 from the end
-	return netip.ParseAddr(keys[len(keys)-2])
+	// keys are in reverse order
+	ip, err = netip.ParseAddr(keys[1])
+	if err != nil {
+		return netip.Addr{}, truncated, err
+	}
+	return normalize(ip), truncated, nil
+}
+
+// parseRemoteAddr parses an http.Request RemoteAddr
+//
+// This is normally host:port, with IPv6 hosts bracketed, but some listeners
+// omit the port and dual-stack listeners may include IPv6 zones.
+func parseRemoteAddr(remoteAddr string) (netip.Addr, error) {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		// no port, but IPv6 may still be bracketed
+		host = strings.TrimSuffix(strings.TrimPrefix(remoteAddr, "["), "]")
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return normalize(ip), nil
+}
+
+// normalize returns ip in the form we use for lookups, without any IPv6
+// zone and with IPv4-mapped IPv6 addresses as IPv4
+func normalize(ip netip.Addr) netip.Addr {
+	return ip.WithZone("").Unmap()
+}
+
+// lastFields returns up to the last limit comma or space separated fields
+// of s in reverse order, limit <= 0 means no limit
+//
+// truncated reports if there were more fields
+func lastFields(s string, limit int) (fields []string, truncated bool) {
+	isSeparator := func(r rune) bool {
+		return r == ',' || r == ' '
+	}
+	for {
+		s = strings.TrimRightFunc(s, isSeparator)
+		if s == "" {
+			return fields, false
+		}
+		if limit > 0 && len(fields) == limit {
+			return fields, true
+		}
+		i := strings.LastIndexFunc(s, isSeparator)
+		fields = append(fields, s[i+1:])
+		s = s[:i+1]
+	}
 }
@@ -19,6 +19,8 @@ package clientip
 import (
 	"net/http"
 	"net/netip"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -104,6 +106,26 @@ func TestGet(t *testing.T) {
 			// We could accept this, we choose to require the load balancer
 			ExpectError: true,
 		},
+		{
+			Name: "X-Forwarded-For for IPv4-mapped IPv6 with load balancer",
+			Request: http.Request{
+				Header: http.Header{
+					"X-Forwarded-For": []string{"::ffff:8.8.8.8, 8.8.8.9"},
+				},
+				RemoteAddr: "127.0.0.1:8888",
+			},
+			ExpectedIP: netip.MustParseAddr("8.8.8.8"),
+		},
+		{
+			Name: "X-Forwarded-For with bogus client-ip",
+			Request: http.Request{
+				Header: http.Header{
+					"X-Forwarded-For": []string{"bogus, 8.8.8.9"},
+				},
+				RemoteAddr: "127.0.0.1:8888",
+			},
+			ExpectError: true,
+		},
 	}
 	for i := range testCases {
 		tc := testCases[i]
@@ -122,3 +144,154 @@ func TestGet(t *testing.T) {
 		})
 	}
 }
+
+func TestGetRemoteAddr(t *testing.T) {
+	testCases := []struct {
+		Name        string
+		RemoteAddr  string
+		ExpectedIP  netip.Addr
+		ExpectError bool
+	}{
+		{
+			Name:       "IPv4 with port",
+			RemoteAddr: "192.0.2.1:8888",
+			ExpectedIP: netip.MustParseAddr("192.0.2.1"),
+		},
+		{
+			Name:       "IPv4 without port",
+			RemoteAddr: "192.0.2.1",
+			ExpectedIP: netip.MustParseAddr("192.0.2.1"),
+		},
+		{
+			Name:       "bracketed IPv6 with port",
+			RemoteAddr: "[2001:db8::1]:8888",
+			ExpectedIP: netip.MustParseAddr("2001:db8::1"),
+		},
+		{
+			Name:       "bracketed IPv6 without port",
+			RemoteAddr: "[2001:db8::1]",
+			ExpectedIP: netip.MustParseAddr("2001:db8::1"),
+		},
+		{
+			Name:       "bare IPv6",
+			RemoteAddr: "2001:db8::1",
+			ExpectedIP: netip.MustParseAddr("2001:db8::1"),
+		},
+		{
+			Name:       "IPv6 with zone and port",
+			RemoteAddr: "[fe80::1%eth0]:8888",
+			ExpectedIP: netip.MustParseAddr("fe80::1"),
+		},
+		{
+			Name:       "IPv6 with zone without port",
+			RemoteAddr: "fe80::1%eth0",
+			ExpectedIP: netip.MustParseAddr("fe80::1"),
+		},
+		{
+			Name:       "IPv4-mapped IPv6 from dual-stack listener",
+			RemoteAddr: "[::ffff:192.0.2.1]:8888",
+			ExpectedIP: netip.MustParseAddr("192.0.2.1"),
+		},
+		{
+			Name:        "empty",
+			RemoteAddr:  "",
+			ExpectError: true,
+		},
+		{
+			Name:        "bogus",
+			RemoteAddr:  "[192.0.2.1:8888",
+			ExpectError: true,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			ip, err := Get(&http.Request{RemoteAddr: tc.RemoteAddr})
+			if err != nil {
+				if !tc.ExpectError {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			} else if tc.ExpectError {
+				t.Fatal("expected error but err was nil")
+			} else if ip != tc.ExpectedIP {
+				t.Fatalf("IP does not match expected IP got: %q, expected: %q", ip, tc.ExpectedIP)
+			}
+		})
+	}
+}
+
+func TestGetLimited(t *testing.T) {
+	// a pathologically long client-supplied header, ahead of the real values
+	hugeXFwdFor := strings.Repeat("1.2.3.4, ", 100000) + "8.8.8.8, 8.8.8.9"
+	testCases := []struct {
+		Name              string
+		XFwdFor           string
+		MaxEntries        int
+		ExpectedIP        netip.Addr
+		ExpectedTruncated bool
+		ExpectError       bool
+	}{
+		{
+			Name:              "huge header, capped",
+			XFwdFor:           hugeXFwdFor,
+			MaxEntries:        2,
+			ExpectedIP:        netip.MustParseAddr("8.8.8.8"),
+			ExpectedTruncated: true,
+		},
+		{
+			Name:       "huge header, unlimited",
+			XFwdFor:    hugeXFwdFor,
+			ExpectedIP: netip.MustParseAddr("8.8.8.8"),
+		},
+		{
+			Name:       "within cap",
+			XFwdFor:    "127.0.0.1, 8.8.8.8, 8.8.8.9, ",
+			MaxEntries: 3,
+			ExpectedIP: netip.MustParseAddr("8.8.8.8"),
+		},
+		{
+			Name:              "cap too small to find client",
+			XFwdFor:           "8.8.8.8,8.8.8.9",
+			MaxEntries:        1,
+			ExpectedTruncated: true,
+			ExpectError:       true,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			r := &http.Request{
+				Header: http.Header{
+					"X-Forwarded-For": []string{tc.XFwdFor},
+				},
+				RemoteAddr: "127.0.0.1:8888",
+			}
+			ip, truncated, err := GetLimited(r, tc.MaxEntries)
+			if truncated != tc.ExpectedTruncated {
+				t.Fatalf("expected truncated: %t, but got: %t", tc.ExpectedTruncated, truncated)
+			}
+			if err != nil {
+				if !tc.ExpectError {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			} else if tc.ExpectError {
+				t.Fatal("expected error but err was nil")
+			} else if ip != tc.ExpectedIP {
+				t.Fatalf("IP does not match expected IP got: %q, expected: %q", ip, tc.ExpectedIP)
+			}
+		})
+	}
+}
+
+func TestLastFieldsBounded(t *testing.T) {
+	fields, truncated := lastFields(strings.Repeat("a,", 100000)+"b, c", 3)
+	if !truncated {
+		t.Fatal("expected fields to be truncated")
+	}
+	expected := []string{"c", "b", "a"}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Fatalf("expected fields: %v, but got: %v", expected, fields)
+	}
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudcidrs
+
+import (
+	"fmt"
+	"net/netip"
+
+	"k8s.io/registry.k8s.io/pkg/net/cloudcidrs/internal/rangesum"
+)
+
+// VerifyIntegrity checks the embedded IP range data against the checksum
+// recorded when it was generated, to catch corrupted data before serving
+func VerifyIntegrity() error {
+	return verifyRanges(regionToRanges, regionToRangesChecksum)
+}
+
+// DataVersion identifies the embedded IP range data, as the checksum
+// recorded when it was generated
+func DataVersion() string {
+	return regionToRangesChecksum
+}
+
+func verifyRanges(ranges map[IPInfo][]netip.Prefix, expected string) error {
+	byCloud := map[string]map[string][]netip.Prefix{}
+	for info, prefixes := range ranges {
+		if byCloud[info.Cloud] == nil {
+			byCloud[info.Cloud] = map[string][]netip.Prefix{}
+		}
+		byCloud[info.Cloud][info.Region] = prefixes
+	}
+	if actual := rangesum.Sum(byCloud); actual != expected {
+		return fmt.Errorf("cloud IP range data checksum mismatch, expected %s but got %s", expected, actual)
+	}
+	return nil
+}
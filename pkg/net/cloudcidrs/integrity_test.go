@@ -0,0 +1,49 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudcidrs
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestVerifyIntegrity(t *testing.T) {
+	if err := VerifyIntegrity(); err != nil {
+		t.Fatalf("unexpected error verifying generated data: %v", err)
+	}
+}
+
+func TestVerifyRangesCorrupted(t *testing.T) {
+	// NOTE: copy so we do not modify the real data
+	corrupted := make(map[IPInfo][]netip.Prefix, len(regionToRanges))
+	for info, prefixes := range regionToRanges {
+		corrupted[info] = prefixes
+	}
+	info := IPInfo{Cloud: AWS, Region: "eu-west-3"}
+	prefixes := append([]netip.Prefix{}, corrupted[info]...)
+	prefixes[0] = netip.PrefixFrom(prefixes[0].Addr(), prefixes[0].Bits()-1)
+	corrupted[info] = prefixes
+	if err := verifyRanges(corrupted, regionToRangesChecksum); err == nil {
+		t.Fatal("expected corrupted data to fail verification")
+	}
+}
+
+func TestDataVersion(t *testing.T) {
+	if DataVersion() != regionToRangesChecksum {
+		t.Fatalf("expected data version to be the checksum, got: %q", DataVersion())
+	}
+}
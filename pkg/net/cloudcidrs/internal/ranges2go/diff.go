@@ -0,0 +1,198 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// datasetDiff describes the changes between two IP range datasets
+type datasetDiff struct {
+	AddedRegions    []string       `json:"addedRegions"`
+	RemovedRegions  []string       `json:"removedRegions"`
+	AddedPrefixes   []prefixChange `json:"addedPrefixes"`
+	RemovedPrefixes []prefixChange `json:"removedPrefixes"`
+	MovedPrefixes   []prefixMove   `json:"movedPrefixes"`
+}
+
+// prefixChange is a prefix added to or removed from region
+type prefixChange struct {
+	Prefix string `json:"prefix"`
+	Region string `json:"region"`
+}
+
+// prefixMove is a prefix that moved from one region to another
+type prefixMove struct {
+	Prefix string `json:"prefix"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+// runDiffDatasets implements the diff-datasets subcommand, writing the diff
+// between two AWS ip-ranges.json or GCP cloud.json files to w
+//
+// This is for reviewing updates to the raw data before regenerating.
+func runDiffDatasets(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("diff-datasets", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	asJSON := fs.Bool("json", false, "write the diff as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New("usage: ranges2go diff-datasets [-json] old.json new.json")
+	}
+	a, err := readDataset(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	b, err := readDataset(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	d := diffDatasets(a, b)
+	if *asJSON {
+		return json.NewEncoder(w).Encode(d)
+	}
+	_, err = io.WriteString(w, d.String())
+	return err
+}
+
+// readDataset reads and parses a raw AWS or GCP IP ranges file
+func readDataset(path string) (regionsToPrefixes, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rtp, err := parseDataset(string(raw))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return rtp, nil
+}
+
+// parseDataset parses raw AWS ip-ranges.json or GCP cloud.json data,
+// detected by the AWS only ipv6_prefixes field
+func parseDataset(raw string) (regionsToPrefixes, error) {
+	var probe struct {
+		IPv6Prefixes json.RawMessage `json:"ipv6_prefixes"`
+	}
+	if err := json.Unmarshal([]byte(raw), &probe); err != nil {
+		return nil, err
+	}
+	if probe.IPv6Prefixes != nil {
+		return parseAWS(raw, nil)
+	}
+	return parseGCP(raw)
+}
+
+// diffDatasets returns the changes from a to b, sorted
+func diffDatasets(a, b regionsToPrefixes) datasetDiff {
+	d := datasetDiff{
+		AddedRegions:    []string{},
+		RemovedRegions:  []string{},
+		AddedPrefixes:   []prefixChange{},
+		RemovedPrefixes: []prefixChange{},
+		MovedPrefixes:   []prefixMove{},
+	}
+	for region := range b {
+		if _, ok := a[region]; !ok {
+			d.AddedRegions = append(d.AddedRegions, region)
+		}
+	}
+	for region := range a {
+		if _, ok := b[region]; !ok {
+			d.RemovedRegions = append(d.RemovedRegions, region)
+		}
+	}
+	aRegions, bRegions := prefixRegions(a), prefixRegions(b)
+	for prefix, region := range bRegions {
+		from, ok := aRegions[prefix]
+		switch {
+		case !ok:
+			d.AddedPrefixes = append(d.AddedPrefixes, prefixChange{Prefix: prefix, Region: region})
+		case from != region:
+			d.MovedPrefixes = append(d.MovedPrefixes, prefixMove{Prefix: prefix, From: from, To: region})
+		}
+	}
+	for prefix, region := range aRegions {
+		if _, ok := bRegions[prefix]; !ok {
+			d.RemovedPrefixes = append(d.RemovedPrefixes, prefixChange{Prefix: prefix, Region: region})
+		}
+	}
+	sort.Strings(d.AddedRegions)
+	sort.Strings(d.RemovedRegions)
+	sortPrefixChanges(d.AddedPrefixes)
+	sortPrefixChanges(d.RemovedPrefixes)
+	sort.Slice(d.MovedPrefixes, func(i, j int) bool {
+		return d.MovedPrefixes[i].Prefix < d.MovedPrefixes[j].Prefix
+	})
+	return d
+}
+
+// prefixRegions maps each prefix in rtp to its region, or if it is in more
+// than one region to the comma separated, sorted regions
+func prefixRegions(rtp regionsToPrefixes) map[string]string {
+	regions := map[string][]string{}
+	for region, prefixes := range rtp {
+		for _, prefix := range prefixes {
+			regions[prefix.String()] = append(regions[prefix.String()], region)
+		}
+	}
+	joined := make(map[string]string, len(regions))
+	for prefix, r := range regions {
+		sort.Strings(r)
+		joined[prefix] = strings.Join(r, ",")
+	}
+	return joined
+}
+
+func sortPrefixChanges(changes []prefixChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Prefix < changes[j].Prefix
+	})
+}
+
+// String returns a human readable report of d, one change per line
+func (d datasetDiff) String() string {
+	sb := &strings.Builder{}
+	for _, region := range d.AddedRegions {
+		fmt.Fprintf(sb, "+ region %s\n", region)
+	}
+	for _, region := range d.RemovedRegions {
+		fmt.Fprintf(sb, "- region %s\n", region)
+	}
+	for _, change := range d.AddedPrefixes {
+		fmt.Fprintf(sb, "+ %s (%s)\n", change.Prefix, change.Region)
+	}
+	for _, change := range d.RemovedPrefixes {
+		fmt.Fprintf(sb, "- %s (%s)\n", change.Prefix, change.Region)
+	}
+	for _, move := range d.MovedPrefixes {
+		fmt.Fprintf(sb, "~ %s (%s -> %s)\n", move.Prefix, move.From, move.To)
+	}
+	fmt.Fprintf(sb, "%d regions added, %d regions removed, %d prefixes added, %d prefixes removed, %d prefixes moved\n",
+		len(d.AddedRegions), len(d.RemovedRegions), len(d.AddedPrefixes), len(d.RemovedPrefixes), len(d.MovedPrefixes))
+	return sb.String()
+}
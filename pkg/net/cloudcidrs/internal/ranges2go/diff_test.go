@@ -0,0 +1,203 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const (
+	diffOldFixture = "testdata/diff-old.json"
+	diffNewFixture = "testdata/diff-new.json"
+)
+
+var expectedFixtureDiff = datasetDiff{
+	AddedRegions:   []string{"ap-southeast-2", "eu-south-2", "us-east-1", "us-east-2"},
+	RemovedRegions: []string{"ap-southeast-4", "eu-south-1", "us-west-1", "us-west-2"},
+	AddedPrefixes: []prefixChange{
+		{Prefix: "15.230.39.0/24", Region: "us-east-2"},
+		{Prefix: "15.230.40.0/24", Region: "us-east-1"},
+	},
+	RemovedPrefixes: []prefixChange{
+		{Prefix: "52.93.178.234/32", Region: "us-west-1"},
+		{Prefix: "52.94.0.0/22", Region: "us-west-2"},
+	},
+	MovedPrefixes: []prefixMove{
+		{Prefix: "13.34.37.64/27", From: "ap-southeast-4", To: "ap-southeast-2"},
+		{Prefix: "2a05:d07a:a000::/40", From: "eu-south-1", To: "eu-south-2"},
+	},
+}
+
+func TestRunDiffDatasetsText(t *testing.T) {
+	t.Parallel()
+	w := &bytes.Buffer{}
+	if err := runDiffDatasets([]string{diffOldFixture, diffNewFixture}, w); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	const expected = `+ region ap-southeast-2
++ region eu-south-2
++ region us-east-1
++ region us-east-2
+- region ap-southeast-4
+- region eu-south-1
+- region us-west-1
+- region us-west-2
++ 15.230.39.0/24 (us-east-2)
++ 15.230.40.0/24 (us-east-1)
+- 52.93.178.234/32 (us-west-1)
+- 52.94.0.0/22 (us-west-2)
+~ 13.34.37.64/27 (ap-southeast-4 -> ap-southeast-2)
+~ 2a05:d07a:a000::/40 (eu-south-1 -> eu-south-2)
+4 regions added, 4 regions removed, 2 prefixes added, 2 prefixes removed, 2 prefixes moved
+`
+	if w.String() != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, w.String())
+	}
+}
+
+func TestRunDiffDatasetsJSON(t *testing.T) {
+	t.Parallel()
+	w := &bytes.Buffer{}
+	if err := runDiffDatasets([]string{"-json", diffOldFixture, diffNewFixture}, w); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var d datasetDiff
+	if err := json.Unmarshal(w.Bytes(), &d); err != nil {
+		t.Fatalf("failed to unmarshal output: %v", err)
+	}
+	if !reflect.DeepEqual(d, expectedFixtureDiff) {
+		t.Fatalf("expected %+v, got %+v", expectedFixtureDiff, d)
+	}
+}
+
+func TestRunDiffDatasetsUnchanged(t *testing.T) {
+	t.Parallel()
+	w := &bytes.Buffer{}
+	if err := runDiffDatasets([]string{"-json", diffOldFixture, diffOldFixture}, w); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// empty lists, not null, so consumers need not special case no changes
+	const expected = `{"addedRegions":[],"removedRegions":[],"addedPrefixes":[],"removedPrefixes":[],"movedPrefixes":[]}` + "\n"
+	if w.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, w.String())
+	}
+}
+
+func TestRunDiffDatasetsErrors(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte(`{"prefixes": [{"ipv4Prefix": "bogus"}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		Name string
+		Args []string
+	}{
+		{Name: "unknown flag", Args: []string{"-bogus", diffOldFixture, diffNewFixture}},
+		{Name: "missing argument", Args: []string{diffOldFixture}},
+		{Name: "missing old file", Args: []string{filepath.Join(dir, "missing.json"), diffNewFixture}},
+		{Name: "invalid new file", Args: []string{diffOldFixture, invalid}},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			if err := runDiffDatasets(tc.Args, &bytes.Buffer{}); err == nil {
+				t.Fatal("expected error but got none")
+			}
+		})
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestRunDiffDatasetsWriteError(t *testing.T) {
+	t.Parallel()
+	if err := runDiffDatasets([]string{diffOldFixture, diffNewFixture}, failingWriter{}); err == nil {
+		t.Fatal("expected error but got none")
+	}
+}
+
+func TestParseDataset(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		Name        string
+		Raw         string
+		Expected    map[string]string
+		ExpectError bool
+	}{
+		{
+			Name:     "aws",
+			Raw:      `{"prefixes": [{"ip_prefix": "3.5.140.0/22", "region": "ap-northeast-2"}], "ipv6_prefixes": []}`,
+			Expected: map[string]string{"3.5.140.0/22": "ap-northeast-2"},
+		},
+		{
+			Name:     "gcp",
+			Raw:      `{"prefixes": [{"ipv4Prefix": "34.80.0.0/15", "scope": "asia-east1"}]}`,
+			Expected: map[string]string{"34.80.0.0/15": "asia-east1"},
+		},
+		{
+			Name:        "invalid json",
+			Raw:         `{`,
+			ExpectError: true,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			rtp, err := parseDataset(tc.Raw)
+			if err != nil {
+				if !tc.ExpectError {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			} else if tc.ExpectError {
+				t.Fatal("expected error but got none")
+			}
+			if got := prefixRegions(rtp); !reflect.DeepEqual(got, tc.Expected) {
+				t.Fatalf("expected %v, got %v", tc.Expected, got)
+			}
+		})
+	}
+}
+
+func TestPrefixRegionsMultipleRegions(t *testing.T) {
+	t.Parallel()
+	rtp, err := parseGCP(`{"prefixes": [
+		{"ipv4Prefix": "34.80.0.0/15", "scope": "us-east1"},
+		{"ipv4Prefix": "34.80.0.0/15", "scope": "asia-east1"}
+	]}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{"34.80.0.0/15": "asia-east1,us-east1"}
+	if got := prefixRegions(rtp); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
@@ -19,7 +19,10 @@ package main
 import (
 	"fmt"
 	"io"
+	"net/netip"
 	"sort"
+
+	"k8s.io/registry.k8s.io/pkg/net/cloudcidrs/internal/rangesum"
 )
 
 const fileHeader = `/*
@@ -85,9 +88,27 @@ var regionToRanges = map[IPInfo][]netip.Prefix{
 		return err
 	}
 
+	// generate checksum of the data, for runtime integrity checks
+	if _, err := fmt.Fprintf(w, `
+// regionToRangesChecksum is the checksum of regionToRanges when generated
+const regionToRangesChecksum = %q
+`, checksum(cloudToRTP),
+	); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// checksum returns the rangesum.Sum of cloudToRTP
+func checksum(cloudToRTP map[string]regionsToPrefixes) string {
+	ranges := make(map[string]map[string][]netip.Prefix, len(cloudToRTP))
+	for cloud, rtp := range cloudToRTP {
+		ranges[cloud] = rtp
+	}
+	return rangesum.Sum(ranges)
+}
+
 func genCloud(w io.Writer, cloud string, rtp regionsToPrefixes) error {
 	// ensure iteration order is predictable for reproducible codegen
 	regions := make([]string, 0, len(rtp))
@@ -186,6 +186,9 @@ var regionToRanges = map[IPInfo][]netip.Prefix{
 		netip.PrefixFrom(netip.AddrFrom16([16]byte{38, 0, 25, 0, 65, 128, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}), 44),
 	},
 }
+
+// regionToRangesChecksum is the checksum of regionToRanges when generated
+const regionToRangesChecksum = "ae0c8cd60283d81783f8fe9a041c6c2489b1b34aa78e1b4cce272f0c61f44099"
 `
 
 	cloudToRTP := map[string]regionsToPrefixes{
@@ -16,6 +16,9 @@ limitations under the License.
 
 // ranges2go generates a go source file with pre-parsed AWS IP ranges data.
 // See also genrawdata.sh for downloading the raw data to this binary.
+//
+// `ranges2go diff-datasets [-json] old.json new.json` instead reports the
+// regions and prefixes added, removed, and moved between two raw data files.
 package main
 
 import (
@@ -26,6 +29,13 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "diff-datasets" {
+		if err := runDiffDatasets(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 	// overridable for make verify
 	outputPath := os.Getenv("OUT_FILE")
 	dataDir := os.Getenv("DATA_DIR")
@@ -0,0 +1,55 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// rangesum computes checksums of cloud IP range data, so that ranges2go can
+// record one at generation time and cloudcidrs can verify it at runtime
+package rangesum
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"sort"
+)
+
+// Sum returns a hex encoded sha256 checksum of ranges, which maps
+// cloud => region => prefixes
+//
+// The result does not depend on map iteration order, but does depend on
+// the order of prefixes within a region.
+func Sum(ranges map[string]map[string][]netip.Prefix) string {
+	h := sha256.New()
+	for _, cloud := range sortedKeys(ranges) {
+		regions := ranges[cloud]
+		for _, region := range sortedKeys(regions) {
+			for _, prefix := range regions[region] {
+				// writes to a hash.Hash never fail
+				_, _ = fmt.Fprintf(h, "%s\t%s\t%s\n", cloud, region, prefix)
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
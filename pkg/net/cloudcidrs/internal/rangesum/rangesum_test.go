@@ -0,0 +1,53 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rangesum
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestSum(t *testing.T) {
+	ranges := func() map[string]map[string][]netip.Prefix {
+		return map[string]map[string][]netip.Prefix{
+			"AWS": {
+				"us-east-1": {netip.MustParsePrefix("3.5.140.0/22"), netip.MustParsePrefix("2a05:d07a:a000::/40")},
+				"eu-west-1": {netip.MustParsePrefix("52.95.174.0/24")},
+			},
+			"GCP": {
+				"us-west4": {netip.MustParsePrefix("34.1.0.0/16")},
+			},
+		}
+	}
+	expected := Sum(ranges())
+	for i := 0; i < 10; i++ {
+		if sum := Sum(ranges()); sum != expected {
+			t.Fatalf("expected stable checksum %q, but got: %q", expected, sum)
+		}
+	}
+	changed := ranges()
+	changed["AWS"]["eu-west-1"][0] = netip.MustParsePrefix("52.95.175.0/24")
+	if sum := Sum(changed); sum == expected {
+		t.Fatal("expected checksum to change with the data")
+	}
+	moved := ranges()
+	moved["AWS"]["eu-west-2"] = moved["AWS"]["eu-west-1"]
+	delete(moved["AWS"], "eu-west-1")
+	if sum := Sum(moved); sum == expected {
+		t.Fatal("expected checksum to change when a prefix moves region")
+	}
+}
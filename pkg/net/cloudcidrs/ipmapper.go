@@ -39,3 +39,12 @@ func AllIPInfos() []IPInfo {
 	}
 	return r
 }
+
+// PrefixCounts returns the number of known IP prefixes for each cloud
+func PrefixCounts() map[string]int {
+	counts := map[string]int{}
+	for info, prefixes := range regionToRanges {
+		counts[info.Cloud] += len(prefixes)
+	}
+	return counts
+}
@@ -146,3 +146,14 @@ func BenchmarkRegionBruteForceIPv6(b *testing.B) {
 		}
 	}
 }
+
+func TestPrefixCounts(t *testing.T) {
+	counts := PrefixCounts()
+	total := 0
+	for _, prefixes := range regionToRanges {
+		total += len(prefixes)
+	}
+	if counts[AWS] == 0 || counts[GCP] == 0 || counts[AWS]+counts[GCP] != total {
+		t.Fatalf("expected AWS and GCP prefixes totalling %d, got: %v", total, counts)
+	}
+}
@@ -10461,3 +10461,6 @@ var regionToRanges = map[IPInfo][]netip.Prefix{
 		netip.PrefixFrom(netip.AddrFrom4([4]byte{34, 37, 0, 0}), 16),
 	},
 }
+
+// regionToRangesChecksum is the checksum of regionToRanges when generated
+const regionToRangesChecksum = "2c38d01241c6f36814cabebc1e4a74e022d487e1a82c4078f84d791b6b3912ce"